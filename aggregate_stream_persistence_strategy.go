@@ -0,0 +1,462 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+
+	eventstore "github.com/go-event-store/eventstore"
+	uuid "github.com/satori/go.uuid"
+)
+
+const AggregateEventsTable = "aggregate_events"
+
+const anyVersion = -1
+
+// AggregateStreamPersistenceStrategy is optimized for one EventStream per Aggregate instance like "order-<uuid>"
+// All Events are persisted in one shared Table keyed by the EventStream ID and a per EventStream version
+// The version is used as event number, so the Events of each EventStream are numbered from 1 without gaps
+type AggregateStreamPersistenceStrategy struct {
+	streamRegistry
+}
+
+func (ps AggregateStreamPersistenceStrategy) CreateEventStreamsTable(ctx context.Context) error {
+	err := ps.streamRegistry.CreateEventStreamsTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	exists, err := ps.tableExists(ctx, ps.db, AggregateEventsTable)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+	_, err = ps.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			no BIGSERIAL,
+			stream_id BIGINT NOT NULL REFERENCES %s (no) ON DELETE CASCADE,
+			version BIGINT NOT NULL,
+			event_id UUID NOT NULL,
+			event_name VARCHAR(100) NOT NULL,
+			payload JSONB,
+			metadata JSONB NOT NULL,
+			created_at TIMESTAMP(6) NOT NULL,
+			content_type VARCHAR(100) NOT NULL DEFAULT 'application/json',
+			payload_bytes BYTEA,
+			PRIMARY KEY (no),
+			CONSTRAINT aggregate_version_not_null CHECK ((metadata->>'_aggregate_version') IS NOT NULL),
+			CONSTRAINT aggregate_type_not_null CHECK ((metadata->>'_aggregate_type') IS NOT NULL),
+			CONSTRAINT aggregate_id_not_null CHECK ((metadata->>'_aggregate_id') IS NOT NULL),
+			UNIQUE (stream_id, version),
+			UNIQUE (event_id),
+			%s
+		);`, ps.table(AggregateEventsTable), ps.table(EventStreamsTable), payloadContentTypeCheck))
+
+	return err
+}
+
+func (ps AggregateStreamPersistenceStrategy) DeleteStream(ctx context.Context, streamName string) error {
+	return ps.RemoveStreamFromStreamsTable(ctx, streamName)
+}
+
+// RenameStream renames the EventStream, its Events are assigned by the unchanged stream id
+func (ps AggregateStreamPersistenceStrategy) RenameStream(ctx context.Context, from, to string) error {
+	return ps.renameStream(ctx, from, to, func(ctx context.Context, tx pgx.Tx) error {
+		return nil
+	})
+}
+
+// CopyStream creates the EventStream to with the metadata of from and a copy of the Events of from matching the matcher
+// Copied Events keep their order but get a new event_id and consecutive versions, it returns the number of copied Events
+func (ps AggregateStreamPersistenceStrategy) CopyStream(ctx context.Context, from, to string, matcher eventstore.MetadataMatcher) (int64, error) {
+	query, values, err := ps.createQuery(ctx, from, 0, 0, 1, matcher)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.copyStream(ctx, from, to, nil, func(ctx context.Context, tx pgx.Tx) (int64, error) {
+		c, err := tx.Exec(
+			ctx,
+			fmt.Sprintf(
+				`INSERT INTO %[1]s (stream_id, version, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at)
+				SELECT streams.no, ROW_NUMBER() OVER (ORDER BY events.no), %[2]s, event_name, payload, payload_bytes, content_type, events.metadata, created_at
+				FROM (%[3]s) AS events, %[4]s AS streams WHERE streams.real_stream_name = $1 ORDER BY events.no`,
+				ps.table(AggregateEventsTable),
+				copiedEventID("event_id", "$1"),
+				query,
+				ps.table(EventStreamsTable),
+			),
+			append([]interface{}{to}, values...)...,
+		)
+
+		return c.RowsAffected(), err
+	})
+}
+
+// StreamInfo returns the statistics of the EventStream, the numbers are the versions of the EventStream
+func (ps AggregateStreamPersistenceStrategy) StreamInfo(ctx context.Context, streamName string) (StreamInfo, error) {
+	infos, err := ps.StreamsInfo(ctx, streamName)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+
+	return infos[0], nil
+}
+
+// StreamsInfo returns the statistics of all given EventStreams in the given order with a single batch of queries
+func (ps AggregateStreamPersistenceStrategy) StreamsInfo(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "version", ps.streamEvents, false)
+}
+
+// StreamsInfoWithAggregates returns the statistics of all given EventStreams like StreamsInfo including their number of distinct aggregates
+// Counting the aggregates reads the metadata of all Events of the EventStreams
+func (ps AggregateStreamPersistenceStrategy) StreamsInfoWithAggregates(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "version", ps.streamEvents, true)
+}
+
+func (ps AggregateStreamPersistenceStrategy) streamEvents(streamName string, streamID int) (string, string, []interface{}) {
+	return ps.table(AggregateEventsTable), "stream_id = $1", []interface{}{streamID}
+}
+
+// PurgeDeletedStreams deletes the EventStreams soft deleted longer than the grace period ago with all their Events
+func (ps AggregateStreamPersistenceStrategy) PurgeDeletedStreams(ctx context.Context, gracePeriod time.Duration) ([]string, error) {
+	return ps.purgeDeletedStreams(ctx, gracePeriod, nil)
+}
+
+// CreateStreamWithMetadata creates a new EventStream like EventStore.CreateStream with initial metadata
+func (ps AggregateStreamPersistenceStrategy) CreateStreamWithMetadata(ctx context.Context, streamName string, metadata map[string]interface{}) error {
+	return ps.createStream(ctx, streamName, metadata, ps.CreateSchema)
+}
+
+func (ps AggregateStreamPersistenceStrategy) CreateSchema(ctx context.Context, streamName string) error {
+	return nil
+}
+
+func (ps AggregateStreamPersistenceStrategy) DropSchema(ctx context.Context, streamName string) error {
+	_, err := ps.db.Exec(
+		ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE stream_id = (SELECT no FROM %s WHERE real_stream_name = $1);`, ps.table(AggregateEventsTable), ps.table(EventStreamsTable)),
+		streamName,
+	)
+
+	return err
+}
+
+func (ps AggregateStreamPersistenceStrategy) AppendTo(ctx context.Context, streamName string, events []eventstore.DomainEvent) error {
+	return ps.appendTo(ctx, streamName, anyVersion, uuid.Nil, events)
+}
+
+// AppendToWithExpectedVersion appends the events if the version of the EventStream equals the expectedVersion
+// With one Aggregate per EventStream the version of the EventStream is the version of the Aggregate
+func (ps AggregateStreamPersistenceStrategy) AppendToWithExpectedVersion(ctx context.Context, streamName string, expectedVersion int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return ps.appendTo(ctx, streamName, expectedVersion, events[0].AggregateID(), events)
+}
+
+// AppendToWithExpectedHead appends the events if the version of the EventStream equals the expectedHead
+func (ps AggregateStreamPersistenceStrategy) AppendToWithExpectedHead(ctx context.Context, streamName string, expectedHead int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return ps.appendTo(ctx, streamName, expectedHead, uuid.Nil, events)
+}
+
+func (ps AggregateStreamPersistenceStrategy) appendTo(ctx context.Context, streamName string, expectedVersion int, aggregateID uuid.UUID, events []eventstore.DomainEvent) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	var streamID, truncatedBefore, version int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT no, truncated_before FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL FOR UPDATE`, ps.table(EventStreamsTable)), streamName).Scan(&streamID, &truncatedBefore)
+	if err == pgx.ErrNoRows {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+	if err != nil {
+		return err
+	}
+
+	if ps.idempotent && expectedVersion == anyVersion {
+		appended, err := alreadyAppended(ctx, tx, streamName, events, fmt.Sprintf(`SELECT event_id FROM %s WHERE event_id = ANY($1::UUID[]) AND stream_id = $2 ORDER BY no`, ps.table(AggregateEventsTable)), streamID)
+		if err != nil || appended {
+			return err
+		}
+	}
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), GREATEST($2::BIGINT - 1, 0)) FROM %s WHERE stream_id = $1`, ps.table(AggregateEventsTable)), streamID, truncatedBefore).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if expectedVersion != anyVersion && version != expectedVersion {
+		return ConcurrencyConflict{Stream: streamName, AggregateID: aggregateID, ExpectedVersion: expectedVersion, ActualVersion: version}
+	}
+
+	batch := &pgx.Batch{}
+
+	for _, ev := range events {
+		version++
+
+		payload, err := ps.serializePayload(ev)
+		if err != nil {
+			return err
+		}
+
+		batch.Queue(
+			fmt.Sprintf(`INSERT INTO %s (stream_id, version, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, ps.table(AggregateEventsTable)),
+			streamID,
+			version,
+			ev.UUID().String(),
+			ev.Name(),
+			payload.payload,
+			payload.bytes,
+			payload.contentType,
+			ps.eventMetadata(ev),
+			ev.CreatedAt(),
+		)
+
+		if ps.outbox {
+			ps.queueOutboxMessage(batch, streamName, ev, payload)
+		}
+	}
+
+	if ps.notify {
+		ps.queueNotification(batch, streamName, `SELECT $3::BIGINT`, version)
+	}
+
+	err = tx.SendBatch(ctx, batch).Close()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BulkAppend appends all Events of the source in one transaction using the COPY protocol and returns their number
+// It is meant for large imports into an EventStream and does not support WithIdempotentAppends
+func (ps AggregateStreamPersistenceStrategy) BulkAppend(ctx context.Context, streamName string, source EventSource) (int64, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	var streamID, truncatedBefore, head int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT no, truncated_before FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL FOR UPDATE`, ps.table(EventStreamsTable)), streamName).Scan(&streamID, &truncatedBefore)
+	if err == pgx.ErrNoRows {
+		return 0, eventstore.StreamNotFound{Stream: streamName}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), GREATEST($2::BIGINT - 1, 0)) FROM %s WHERE stream_id = $1`, ps.table(AggregateEventsTable)), streamID, truncatedBefore).Scan(&head)
+	if err != nil {
+		return 0, err
+	}
+
+	version := head
+
+	count, err := ps.copyEvents(ctx, tx, AggregateEventsTable, []string{"stream_id", "version", "event_id", "event_name", "payload", "payload_bytes", "content_type", "metadata", "created_at"}, source, func(ev eventstore.DomainEvent) ([]interface{}, error) {
+		version++
+
+		payload, err := ps.serializePayload(ev)
+
+		return []interface{}{streamID, version, ev.UUID().String(), ev.Name(), payload.payload, payload.bytes, payload.contentType, ps.eventMetadata(ev), ev.CreatedAt()}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := &pgx.Batch{}
+
+	if ps.outbox {
+		ps.queueOutboxCopy(batch, streamName, fmt.Sprintf(`FROM %s WHERE stream_id = $2 AND version > $3 ORDER BY version`, ps.table(AggregateEventsTable)), streamID, head)
+	}
+	if ps.notify && count > 0 {
+		ps.queueNotification(batch, streamName, `SELECT $3::BIGINT`, version)
+	}
+
+	err = sendBatch(ctx, tx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+// TruncateStreamBefore removes all Events with a lower version and returns the number of removed Events
+// With archive the Events are moved into the Table named by GenerateArchiveTableName instead
+func (ps AggregateStreamPersistenceStrategy) TruncateStreamBefore(ctx context.Context, streamName string, number int, archive bool) (int64, error) {
+	return ps.truncateStream(
+		ctx,
+		streamName,
+		number,
+		archive,
+		AggregateEventsTable,
+		fmt.Sprintf(`stream_id = (SELECT no FROM %s WHERE real_stream_name = $2) AND version < $1`, ps.table(EventStreamsTable)),
+		streamName,
+	)
+}
+
+// TruncateStreamBeforeTime removes all Events before the first Event created at or after the given time
+func (ps AggregateStreamPersistenceStrategy) TruncateStreamBeforeTime(ctx context.Context, streamName string, createdAt time.Time, archive bool) (int64, error) {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+
+	err = ps.db.QueryRow(
+		ctx,
+		fmt.Sprintf(`
+			SELECT COALESCE(MIN(events.version), (SELECT COALESCE(MAX(version), 0) + 1 FROM %[1]s WHERE stream_id = streams.no))
+			FROM %[2]s AS streams LEFT JOIN %[1]s AS events ON events.stream_id = streams.no AND events.created_at >= $2
+			WHERE streams.real_stream_name = $1
+			GROUP BY streams.no`, ps.table(AggregateEventsTable), ps.table(EventStreamsTable)),
+		streamName,
+		createdAt,
+	).Scan(&number)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.TruncateStreamBefore(ctx, streamName, number, archive)
+}
+
+// Load returns StreamTruncated if fromNumber is before the truncation point of the EventStream, 0 loads from the oldest available Event
+func (ps AggregateStreamPersistenceStrategy) Load(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, fromNumber, 0, 0, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.newIterator(ctx, query, values, count), nil
+}
+
+// LoadReverse loads Events of the given EventStream newest first, beginning with fromNumber or with the latest Event if fromNumber is 0
+func (ps AggregateStreamPersistenceStrategy) LoadReverse(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, 0, 0, 0, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.newReverseIterator(ctx, query, values, fromNumber, count), nil
+}
+
+func (ps AggregateStreamPersistenceStrategy) MergeAndLoad(ctx context.Context, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, 0, count, streams...)
+}
+
+// MergeAndLoadFromPosition loads Events of multiple EventStreams in the order of their global position, beginning with fromPosition
+func (ps AggregateStreamPersistenceStrategy) MergeAndLoadFromPosition(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, fromPosition, count, streams...)
+}
+
+func (ps AggregateStreamPersistenceStrategy) mergeAndLoad(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (*DomainEventIterator, error) {
+	var paramCounter int
+	var queries []string
+	var parameters []interface{}
+
+	for _, stream := range streams {
+		query, values, err := ps.createQuery(ctx, stream.StreamName, stream.FromNumber, fromPosition, paramCounter, stream.Matcher)
+		if err != nil {
+			return nil, err
+		}
+
+		paramCounter += len(values)
+		queries = append(queries, "("+query+")")
+		parameters = append(parameters, values...)
+	}
+
+	groupedQuery := strings.Join(queries, " UNION ALL ")
+	it := ps.newIterator(ctx, groupedQuery, parameters, count)
+
+	if len(queries) > 1 || fromPosition > 0 {
+		it.orderBy = mergedStreamsOrder
+	}
+
+	return it, nil
+}
+
+// fetchStreamID returns the id referenced by the aggregate_events of the EventStream
+func (ps AggregateStreamPersistenceStrategy) fetchStreamID(ctx context.Context, streamName string) (int, error) {
+	var streamID int
+
+	err := ps.db.QueryRow(ctx, fmt.Sprintf(`SELECT no FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL`, ps.table(EventStreamsTable)), streamName).Scan(&streamID)
+	if err == pgx.ErrNoRows {
+		return 0, eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return streamID, err
+}
+
+func (ps AggregateStreamPersistenceStrategy) createQuery(ctx context.Context, streamName string, fromNumber, fromPosition, paramCounter int, matcher eventstore.MetadataMatcher) (string, []interface{}, error) {
+	streamID, err := ps.fetchStreamID(ctx, streamName)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+
+	wheres, values, err := createWhereClause(paramCounter, matcher, aggregateMessageProperties)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+
+	wheres = append(wheres, fmt.Sprintf(`stream_id = $%d`, paramCounter+len(values)+1))
+	values = append(values, streamID)
+
+	wheres = append(wheres, fmt.Sprintf(`version >= $%d`, paramCounter+len(values)+1))
+	values = append(values, fromNumber)
+
+	if fromPosition > 0 {
+		wheres = append(wheres, fmt.Sprintf(`no >= $%d`, paramCounter+len(values)+1))
+		values = append(values, fromPosition)
+	}
+
+	whereCondition := fmt.Sprintf(`WHERE %s`, strings.Join(wheres, " AND "))
+
+	query := fmt.Sprintf(`SELECT version AS no, event_id, event_name, payload, metadata, created_at, $%d::TEXT AS stream, no AS position, content_type, payload_bytes FROM %s %s`, paramCounter+len(values)+1, ps.table(AggregateEventsTable), whereCondition)
+	values = append(values, streamName)
+
+	return query, values, nil
+}
+
+func NewAggregateStreamPersistenceStrategy(db *pgxpool.Pool, options ...Option) *AggregateStreamPersistenceStrategy {
+	return &AggregateStreamPersistenceStrategy{
+		streamRegistry: streamRegistry{config: newConfig(options), db: db, migrations: aggregateStreamMigrations, strategy: aggregateStreamStrategy},
+	}
+}
@@ -0,0 +1,95 @@
+package pg
+
+import (
+	"context"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// EventSource provides the Events of a BulkAppend, it is implemented by every DomainEventIterator
+type EventSource interface {
+	Next() bool
+	Current() (*eventstore.DomainEvent, error)
+	Error() error
+}
+
+type channelSource struct {
+	ctx     context.Context
+	events  <-chan eventstore.DomainEvent
+	current *eventstore.DomainEvent
+	err     error
+}
+
+func (s *channelSource) Next() bool {
+	select {
+	case event, ok := <-s.events:
+		if !ok {
+			return false
+		}
+
+		s.current = &event
+		return true
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+		return false
+	}
+}
+
+func (s *channelSource) Current() (*eventstore.DomainEvent, error) {
+	return s.current, s.err
+}
+
+func (s *channelSource) Error() error {
+	return s.err
+}
+
+// EventChannel creates an EventSource receiving Events until the channel is closed or the context is done
+func EventChannel(ctx context.Context, events <-chan eventstore.DomainEvent) EventSource {
+	return &channelSource{ctx: ctx, events: events}
+}
+
+// eventCopySource adapts an EventSource to the rows of a CopyFrom
+type eventCopySource struct {
+	source  EventSource
+	row     func(event eventstore.DomainEvent) ([]interface{}, error)
+	current *eventstore.DomainEvent
+	err     error
+}
+
+func (s *eventCopySource) Next() bool {
+	if !s.source.Next() {
+		return false
+	}
+
+	s.current, s.err = s.source.Current()
+
+	return s.err == nil && s.current != nil
+}
+
+func (s *eventCopySource) Values() ([]interface{}, error) {
+	return s.row(*s.current)
+}
+
+func (s *eventCopySource) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.source.Error()
+}
+
+// sendBatch sends the queued statements within tx, if any
+func sendBatch(ctx context.Context, tx pgx.Tx, batch *pgx.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// copyEvents copies all Events of the source into the table within tx
+// The Events are not validated before, all CHECK constraints and unique indexes of the table are enforced by Postgres
+func (c config) copyEvents(ctx context.Context, tx pgx.Tx, tableName string, columns []string, source EventSource, row func(event eventstore.DomainEvent) ([]interface{}, error)) (int64, error) {
+	return tx.CopyFrom(ctx, c.identifier(tableName), columns, &eventCopySource{source: source, row: row})
+}
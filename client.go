@@ -5,11 +5,11 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/jackc/pgx/v4"
 	pgxpool "github.com/jackc/pgx/v4/pgxpool"
 )
 
 type Client struct {
+	config
 	db *pgxpool.Pool
 }
 
@@ -17,30 +17,32 @@ func (c *Client) Conn() interface{} {
 	return c.db
 }
 
+// Table returns the quoted and schema qualified name of the given collection
+func (c *Client) Table(collection string) string {
+	return c.table(collection)
+}
+
+// Exists looks up the collection in the configured schema, without WithSchema a Table of the name in any schema counts
 func (c *Client) Exists(ctx context.Context, collection string) (bool, error) {
-	var tablename string
+	if c.schema != "" {
+		return c.tableExists(ctx, c.db, collection)
+	}
 
-	row := c.db.QueryRow(ctx, `SELECT tablename FROM pg_catalog.pg_tables WHERE tablename = $1;`, collection)
-	err := row.Scan(&tablename)
+	var exists bool
 
-	if err == pgx.ErrNoRows {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
+	err := c.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_tables WHERE tablename = $1)`, c.prefix+collection).Scan(&exists)
 
-	return true, nil
+	return exists, err
 }
 
 func (c *Client) Delete(ctx context.Context, collection string) error {
-	_, err := c.db.Exec(ctx, `DROP TABLE IF EXISTS "`+collection+`";`)
+	_, err := c.db.Exec(ctx, `DROP TABLE IF EXISTS `+c.table(collection)+`;`)
 
 	return err
 }
 
 func (c *Client) Reset(ctx context.Context, collection string) error {
-	_, err := c.db.Exec(ctx, `TRUNCATE TABLE "`+collection+`" RESTART IDENTITY;`)
+	_, err := c.db.Exec(ctx, `TRUNCATE TABLE `+c.table(collection)+` RESTART IDENTITY;`)
 
 	return err
 }
@@ -62,7 +64,7 @@ func (c *Client) Insert(ctx context.Context, collection string, values map[strin
 
 	_, err := c.db.Exec(
 		ctx,
-		`INSERT INTO "`+collection+`" ("`+strings.Join(columns, `","`)+`") VALUES (`+strings.Join(placeholder, ",")+`);`,
+		`INSERT INTO `+c.table(collection)+` ("`+strings.Join(columns, `","`)+`") VALUES (`+strings.Join(placeholder, ",")+`);`,
 		parameters...,
 	)
 
@@ -84,7 +86,7 @@ func (c *Client) Remove(ctx context.Context, collection string, identifiers map[
 
 	_, err := c.db.Exec(
 		ctx,
-		`DELETE FROM "`+collection+`" WHERE `+strings.Join(conditions, " AND ")+`;`,
+		`DELETE FROM `+c.table(collection)+` WHERE `+strings.Join(conditions, " AND ")+`;`,
 		parameters...,
 	)
 
@@ -114,13 +116,13 @@ func (c *Client) Update(ctx context.Context, collection string, values map[strin
 
 	_, err := c.db.Exec(
 		ctx,
-		`UPDATE "`+collection+`" SET `+strings.Join(updates, ",")+` WHERE `+strings.Join(conditions, " AND ")+`;`,
+		`UPDATE `+c.table(collection)+` SET `+strings.Join(updates, ",")+` WHERE `+strings.Join(conditions, " AND ")+`;`,
 		parameters...,
 	)
 
 	return err
 }
 
-func NewClient(db *pgxpool.Pool) *Client {
-	return &Client{db: db}
+func NewClient(db *pgxpool.Pool, options ...Option) *Client {
+	return &Client{config: newConfig(options), db: db}
 }
@@ -196,4 +196,46 @@ func Test_PostgresClient(t *testing.T) {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("Table Handling with Schema and Prefix", func(t *testing.T) {
+		client := pg.NewClient(db, pg.WithSchema("bounded_context"), pg.WithTablePrefix("bc_"))
+
+		_, err := client.Conn().(*pgxpool.Pool).Exec(ctx, `CREATE SCHEMA IF NOT EXISTS bounded_context`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Conn().(*pgxpool.Pool).Exec(ctx, `CREATE TABLE `+client.Table("schema_test")+` (name VARCHAR(150) NOT NULL);`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exists, err := client.Exists(ctx, "schema_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatal("existing table should be found")
+		}
+
+		err = client.Insert(ctx, "schema_test", map[string]interface{}{"name": "Rudi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var name string
+
+		err = client.Conn().(*pgxpool.Pool).QueryRow(ctx, "SELECT name FROM bounded_context.bc_schema_test").Scan(&name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "Rudi" {
+			t.Error("unexpected name value")
+		}
+
+		err = client.Delete(ctx, "schema_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
 }
@@ -0,0 +1,90 @@
+package pg
+
+import (
+	"fmt"
+
+	eventstore "github.com/go-event-store/eventstore"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ConcurrencyConflict is returned if the expected version of an Aggregate or EventStream does not match the persisted one
+// AggregateID is uuid.Nil if the conflict was detected on the head of the EventStream
+type ConcurrencyConflict struct {
+	Stream          string
+	AggregateID     uuid.UUID
+	ExpectedVersion int
+	ActualVersion   int
+}
+
+func (e ConcurrencyConflict) Error() string {
+	if uuid.Equal(e.AggregateID, uuid.Nil) {
+		return fmt.Sprintf("Concurrency conflict on Stream %s: expected head %d, actual head %d", e.Stream, e.ExpectedVersion, e.ActualVersion)
+	}
+
+	return fmt.Sprintf("Concurrency conflict on Stream %s for Aggregate %s: expected version %d, actual version %d", e.Stream, e.AggregateID, e.ExpectedVersion, e.ActualVersion)
+}
+
+// SnapshotNotFound is returned if no Snapshot was saved for the Aggregate yet
+type SnapshotNotFound struct {
+	AggregateType string
+	AggregateID   uuid.UUID
+}
+
+func (e SnapshotNotFound) Error() string {
+	return fmt.Sprintf("Snapshot for Aggregate %s %s not found", e.AggregateType, e.AggregateID)
+}
+
+// IdempotencyViolation is returned by an idempotent AppendTo if only a part of the Events was already appended
+// or the already appended Events have a different order
+type IdempotencyViolation struct {
+	Stream   string
+	EventIDs []uuid.UUID
+}
+
+func (e IdempotencyViolation) Error() string {
+	return fmt.Sprintf("Idempotency violation on Stream %s: %d of the Events were already appended in a different batch", e.Stream, len(e.EventIDs))
+}
+
+// StreamTruncated is returned by Load and LoadReverse if the requested Events were removed by a truncation of the EventStream
+// TruncatedBefore is the number of the oldest Event which can still be loaded
+type StreamTruncated struct {
+	Stream          string
+	FromNumber      int
+	TruncatedBefore int
+}
+
+func (e StreamTruncated) Error() string {
+	return fmt.Sprintf("Stream %s was truncated before %d, Events from %d are no longer available", e.Stream, e.TruncatedBefore, e.FromNumber)
+}
+
+// StreamSoftDeleted is returned by CreateStream if an EventStream of the name was soft deleted
+// The name stays reserved until the EventStream is undeleted or purged
+type StreamSoftDeleted struct {
+	Stream string
+}
+
+func (e StreamSoftDeleted) Error() string {
+	return fmt.Sprintf("Stream %s is soft deleted, undelete or purge it before creating it again", e.Stream)
+}
+
+// PartitionNotFound is returned if the Partition does not belong to the partitioned EventStream
+type PartitionNotFound struct {
+	Stream    string
+	Partition string
+}
+
+func (e PartitionNotFound) Error() string {
+	return fmt.Sprintf("Partition %s of Stream %s not found", e.Partition, e.Stream)
+}
+
+// InvalidMessagePropertyMatch is returned if a MessagePropertyField matcher uses an unknown field,
+// an unsupported operator or a value which can not be compared with the field
+type InvalidMessagePropertyMatch struct {
+	Field     string
+	Operation eventstore.MetadataOperator
+	Value     interface{}
+}
+
+func (e InvalidMessagePropertyMatch) Error() string {
+	return fmt.Sprintf("Invalid MessageProperty match: %s %s %v (%T)", e.Field, e.Operation, e.Value, e.Value)
+}
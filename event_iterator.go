@@ -2,9 +2,10 @@ package pg
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	eventstore "github.com/go-event-store/eventstore"
@@ -13,10 +14,19 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+// mergedStreamsOrder is the keyset of Events merged from multiple EventStreams, event numbers are only unique per EventStream
+var mergedStreamsOrder = []string{"position"}
+
 type DomainEventIterator struct {
 	limit        int
-	offset       int
 	count        int
+	fetched      int
+	orderBy      []string
+	firstKey     map[string]interface{}
+	lastKey      map[string]interface{}
+	descending   bool
+	streaming    bool
+	released     int
 	position     int
 	length       int
 	done         bool
@@ -25,6 +35,8 @@ type DomainEventIterator struct {
 	events       []*eventstore.DomainEvent
 	db           *pgxpool.Pool
 	typeRegistry eventstore.TypeRegistry
+	upcasters    *Upcasters
+	serializers  []Serializer
 	query        string
 	parameters   []interface{}
 	ctx          context.Context
@@ -34,14 +46,14 @@ func (it *DomainEventIterator) Next() bool {
 	it.position++
 
 	if it.length >= it.position+1 {
-		it.current = it.events[it.position]
+		it.current = it.events[it.position-it.released]
 		return true
 	}
 
 	it.fetchEvents()
 
 	if it.length >= it.position+1 {
-		it.current = it.events[it.position]
+		it.current = it.events[it.position-it.released]
 		return true
 	}
 
@@ -58,10 +70,21 @@ func (it *DomainEventIterator) Current() (*eventstore.DomainEvent, error) {
 	return it.current, it.err
 }
 
+// Rewind the iterator cursor
+// If already fetched Events were released, by Close or in streaming mode, the EventStream is queried again from the beginning
 func (it *DomainEventIterator) Rewind() {
 	it.current = nil
 	it.err = nil
 	it.position = -1
+
+	if it.released > 0 {
+		it.events = make([]*eventstore.DomainEvent, 0)
+		it.released = 0
+		it.length = 0
+		it.fetched = 0
+		it.lastKey = it.firstKey
+		it.done = false
+	}
 }
 
 func (it *DomainEventIterator) Error() error {
@@ -70,6 +93,7 @@ func (it *DomainEventIterator) Error() error {
 
 func (it *DomainEventIterator) Close() {
 	it.current = nil
+	it.released = it.length
 	it.events = make([]*eventstore.DomainEvent, 0)
 }
 
@@ -98,43 +122,105 @@ func (it *DomainEventIterator) fetchEvents() {
 		return
 	}
 
-	query := it.query
 	limit := it.limit
 
-	if it.count > 0 && it.count < it.limit {
-		limit = it.count
+	if it.count > 0 && it.count-it.fetched < it.limit {
+		limit = it.count - it.fetched
+	}
+	if limit <= 0 {
+		it.done = true
+		return
 	}
 
-	query = fmt.Sprintf("%s LIMIT %d OFFSET %d", query, limit, it.offset)
+	query, parameters := it.nextPageQuery(limit)
+
+	if it.streaming {
+		it.released = it.length
+		it.events = make([]*eventstore.DomainEvent, 0, limit)
+	}
 
-	rows, err := it.db.Query(it.ctx, query, it.parameters...)
+	rows, err := it.db.Query(it.ctx, query, parameters...)
 	if err != nil {
 		it.err = err
 		return
 	}
+	defer rows.Close()
 
 	counter := it.appendRows(rows)
+	if it.err == nil {
+		it.err = rows.Err()
+	}
 
-	if counter < limit {
+	if counter < limit || it.err != nil {
 		it.done = true
 	}
 
-	it.count -= counter
-	it.offset += counter
+	it.fetched += counter
 	it.length += counter
 }
 
+// nextPageQuery uses the orderBy columns of the last fetched Event as keyset instead of an OFFSET
+// so each page is an index range scan, independent of the number of already fetched Events
+func (it *DomainEventIterator) nextPageQuery(limit int) (string, []interface{}) {
+	query := fmt.Sprintf("SELECT * FROM (%s) AS events", it.query)
+	parameters := it.parameters
+	comparison, direction := ">", "ASC"
+
+	if it.descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	if it.lastKey != nil {
+		placeholders := make([]string, 0, len(it.orderBy))
+		parameters = make([]interface{}, 0, len(it.parameters)+len(it.orderBy))
+		parameters = append(parameters, it.parameters...)
+
+		for _, column := range it.orderBy {
+			parameters = append(parameters, it.lastKey[column])
+			placeholders = append(placeholders, "$"+strconv.Itoa(len(parameters)))
+		}
+
+		query = fmt.Sprintf("%s WHERE (%s) %s (%s)", query, strings.Join(it.orderBy, ", "), comparison, strings.Join(placeholders, ", "))
+	}
+
+	query = fmt.Sprintf("%s ORDER BY %s LIMIT %d", query, strings.Join(it.orderBy, " "+direction+", ")+" "+direction, limit)
+
+	return query, parameters
+}
+
 func (it *DomainEventIterator) appendRows(rows pgx.Rows) int {
 	counter := 0
 
 	for rows.Next() {
-		var name, eventID, stream string
-		var number int
+		var name, eventID, stream, contentType string
+		var number, globalPosition int
 		var metadata map[string]interface{}
-		var payload []byte
+		var payload, payloadBytes []byte
 		var createdAt time.Time
 
-		it.err = rows.Scan(&number, &eventID, &name, &payload, &metadata, &createdAt, &stream)
+		it.err = rows.Scan(&number, &eventID, &name, &payload, &metadata, &createdAt, &stream, &globalPosition, &contentType, &payloadBytes)
+		if it.err != nil {
+			return counter
+		}
+
+		if contentType != JSONContentType {
+			payload = payloadBytes
+		}
+
+		if it.upcasters != nil {
+			var event RawEvent
+
+			event, it.err = it.upcasters.Upcast(RawEvent{Name: name, ContentType: contentType, Payload: payload, Metadata: metadata})
+			if it.err != nil {
+				return counter
+			}
+
+			name, contentType, payload, metadata = event.Name, event.ContentType, event.Payload, event.Metadata
+		}
+
+		var serializer Serializer
+
+		serializer, it.err = findSerializer(it.serializers, contentType)
 		if it.err != nil {
 			return counter
 		}
@@ -143,9 +229,10 @@ func (it *DomainEventIterator) appendRows(rows pgx.Rows) int {
 
 		eventValue := reflect.New(eventType)
 		eventInterface := eventValue.Interface()
-		it.err = json.Unmarshal(payload, eventInterface)
+		it.err = serializer.Unmarshal(payload, eventInterface)
 
-		metadata["stream"] = stream
+		metadata[StreamKey] = stream
+		metadata[positionKey] = globalPosition
 
 		event := eventstore.
 			NewDomainEvent(uuid.NewV4(), reflect.Indirect(eventValue).Interface(), metadata, createdAt).
@@ -153,6 +240,7 @@ func (it *DomainEventIterator) appendRows(rows pgx.Rows) int {
 			WithNumber(number)
 
 		it.events = append(it.events, &event)
+		it.lastKey = map[string]interface{}{"no": number, "position": globalPosition}
 
 		counter++
 	}
@@ -163,8 +251,14 @@ func (it *DomainEventIterator) appendRows(rows pgx.Rows) int {
 func NewDomainEventIterator(ctx context.Context, db *pgxpool.Pool, query string, parameters []interface{}, count int) *DomainEventIterator {
 	return &DomainEventIterator{
 		limit:        1000,
-		offset:       0,
 		count:        count,
+		fetched:      0,
+		orderBy:      []string{"no"},
+		firstKey:     nil,
+		lastKey:      nil,
+		descending:   false,
+		streaming:    false,
+		released:     0,
 		position:     -1,
 		length:       0,
 		current:      nil,
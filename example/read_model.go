@@ -25,7 +25,7 @@ func (f *FooReadModel) Init(ctx context.Context) error {
 			aggregate_id UUID NOT NULL,
 			value VARCHAR(20) NOT NULL,
 			PRIMARY KEY (id)
-		)`, FooReadmodelTable))
+		)`, f.client.Table(FooReadmodelTable)))
 
 	return err
 }
@@ -0,0 +1,56 @@
+package pg
+
+import (
+	"context"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+	uuid "github.com/satori/go.uuid"
+)
+
+// alreadyAppended reports if all events were appended to the EventStream by a previous call
+// query has to select the event_id of the Events of the EventStream matching $1::UUID[] ordered by their number
+func alreadyAppended(ctx context.Context, tx pgx.Tx, streamName string, events []eventstore.DomainEvent, query string, arguments ...interface{}) (bool, error) {
+	eventIDs := make([]string, 0, len(events))
+
+	for _, ev := range events {
+		eventIDs = append(eventIDs, ev.UUID().String())
+	}
+
+	rows, err := tx.Query(ctx, query, append([]interface{}{eventIDs}, arguments...)...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	persisted := []uuid.UUID{}
+
+	for rows.Next() {
+		var eventID string
+
+		err = rows.Scan(&eventID)
+		if err != nil {
+			return false, err
+		}
+
+		persisted = append(persisted, uuid.FromStringOrNil(eventID))
+	}
+	if rows.Err() != nil {
+		return false, rows.Err()
+	}
+
+	if len(persisted) == 0 {
+		return false, nil
+	}
+	if len(persisted) != len(events) {
+		return false, IdempotencyViolation{Stream: streamName, EventIDs: persisted}
+	}
+
+	for i, ev := range events {
+		if !uuid.Equal(ev.UUID(), persisted[i]) {
+			return false, IdempotencyViolation{Stream: streamName, EventIDs: persisted}
+		}
+	}
+
+	return true, nil
+}
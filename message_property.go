@@ -0,0 +1,202 @@
+package pg
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	eventstore "github.com/go-event-store/eventstore"
+	uuid "github.com/satori/go.uuid"
+)
+
+// messageProperty describes the column a MessagePropertyField filters and the Postgres type its values are cast to
+type messageProperty struct {
+	column   string
+	dataType string
+}
+
+// messageProperties whitelists the MessagePropertyField names, "uuid" is the name used by the eventstore package for the event_id
+var messageProperties = map[string]messageProperty{
+	"event_name": {column: "event_name", dataType: "TEXT"},
+	"created_at": {column: "created_at", dataType: "TIMESTAMP"},
+	"uuid":       {column: "event_id", dataType: "UUID"},
+	"event_id":   {column: "event_id", dataType: "UUID"},
+	"no":         {column: "no", dataType: "BIGINT"},
+}
+
+// aggregateMessageProperties filters the number of an Event by the version column of the aggregate_events Table
+var aggregateMessageProperties = map[string]messageProperty{
+	"event_name": messageProperties["event_name"],
+	"created_at": messageProperties["created_at"],
+	"uuid":       messageProperties["uuid"],
+	"event_id":   messageProperties["event_id"],
+	"no":         {column: "version", dataType: "BIGINT"},
+}
+
+func messagePropertyWhereClause(properties map[string]messageProperty, match eventstore.MetadataMatch, placeholder string) (string, interface{}, error) {
+	property, ok := properties[match.Field]
+	if !ok {
+		return "", nil, InvalidMessagePropertyMatch{Field: match.Field, Operation: match.Operation, Value: match.Value}
+	}
+
+	switch match.Operation {
+	case eventstore.RegexOperator:
+		pattern, ok := match.Value.(string)
+		if !ok {
+			return "", nil, InvalidMessagePropertyMatch{Field: match.Field, Operation: match.Operation, Value: match.Value}
+		}
+
+		return fmt.Sprintf(`%s::TEXT ~ %s`, property.column, placeholder), pattern, nil
+	case eventstore.InOperator, eventstore.NotInOperator:
+		values, ok := messagePropertyValues(property.dataType, match.Value)
+		if !ok {
+			return "", nil, InvalidMessagePropertyMatch{Field: match.Field, Operation: match.Operation, Value: match.Value}
+		}
+
+		if match.Operation == eventstore.NotInOperator {
+			return fmt.Sprintf(`%s <> ALL(%s::%s[])`, property.column, placeholder, property.dataType), values, nil
+		}
+
+		return fmt.Sprintf(`%s = ANY(%s::%s[])`, property.column, placeholder, property.dataType), values, nil
+	case eventstore.EqualsOperator, eventstore.NotEqualsOperator,
+		eventstore.GreaterThanOperator, eventstore.GreaterThanEqualsOperator,
+		eventstore.LowerThanOperator, eventstore.LowerThanEuqalsOperator:
+		value, ok := messagePropertyValue(property.dataType, match.Value)
+		if !ok {
+			return "", nil, InvalidMessagePropertyMatch{Field: match.Field, Operation: match.Operation, Value: match.Value}
+		}
+
+		return fmt.Sprintf(`%s %s %s::%s`, property.column, match.Operation, placeholder, property.dataType), value, nil
+	default:
+		return "", nil, InvalidMessagePropertyMatch{Field: match.Field, Operation: match.Operation, Value: match.Value}
+	}
+}
+
+// messagePropertyValue converts the matched value into the Go type pgx encodes as the Postgres type of the property
+func messagePropertyValue(dataType string, value interface{}) (interface{}, bool) {
+	switch dataType {
+	case "TIMESTAMP":
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, false
+			}
+
+			return t, true
+		}
+	case "UUID":
+		switch v := value.(type) {
+		case uuid.UUID:
+			return v.String(), true
+		case string:
+			id, err := uuid.FromString(v)
+			if err != nil {
+				return nil, false
+			}
+
+			return id.String(), true
+		}
+	case "BIGINT":
+		switch v := value.(type) {
+		case int:
+			return int64(v), true
+		case int32:
+			return int64(v), true
+		case int64:
+			return v, true
+		case float32:
+			return integralFloat(float64(v))
+		case float64:
+			return integralFloat(v)
+		}
+	case "TEXT":
+		v, ok := value.(string)
+		return v, ok
+	}
+
+	return nil, false
+}
+
+// messagePropertyValues converts each value of an InOperator or NotInOperator slice
+func messagePropertyValues(dataType string, value interface{}) (interface{}, bool) {
+	var items []interface{}
+
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []time.Time:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []uuid.UUID:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []int:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []int64:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []float64:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	default:
+		return nil, false
+	}
+
+	switch dataType {
+	case "TIMESTAMP":
+		values := make([]time.Time, 0, len(items))
+		for _, item := range items {
+			converted, ok := messagePropertyValue(dataType, item)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, converted.(time.Time))
+		}
+
+		return values, true
+	case "BIGINT":
+		values := make([]int64, 0, len(items))
+		for _, item := range items {
+			converted, ok := messagePropertyValue(dataType, item)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, converted.(int64))
+		}
+
+		return values, true
+	default:
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			converted, ok := messagePropertyValue(dataType, item)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, converted.(string))
+		}
+
+		return values, true
+	}
+}
+
+// integralFloat accepts event numbers decoded from JSON as float64, as long as they have no fraction
+func integralFloat(v float64) (interface{}, bool) {
+	if v != math.Trunc(v) {
+		return nil, false
+	}
+
+	return int64(v), true
+}
@@ -0,0 +1,418 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const MigrationsTable = "event_store_migrations"
+
+const (
+	tablePerStreamStrategy  = "table_per_stream"
+	singleTableStrategy     = "single_table"
+	aggregateStreamStrategy = "aggregate_stream"
+)
+
+// Migration is a versioned change of existing EventStore Tables
+// Migrations are applied once and in order of their Version by Migrate
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(ctx context.Context, c config, tx pgx.Tx) error
+}
+
+var streamRegistryMigrations = []Migration{
+	{Version: 1, Description: "Index EventStream metadata", apply: indexStreamMetadata},
+	{Version: 3, Description: "Track EventStream truncation", apply: addStreamTruncation},
+	{Version: 4, Description: "Soft delete EventStreams", apply: addStreamDeletion},
+}
+
+var singleTableMigrations = append(append([]Migration{}, streamRegistryMigrations...),
+	Migration{Version: 6, Description: "Store payloads as JSONB", apply: convertPayloads(EventsTable)},
+	Migration{Version: 7, Description: "Store payload content types", apply: addPayloadContentTypes(EventsTable)},
+	Migration{Version: 8, Description: "Number Events per EventStream", apply: addEventNumbers},
+)
+
+var aggregateStreamMigrations = append(append([]Migration{}, streamRegistryMigrations...),
+	Migration{Version: 6, Description: "Store payloads as JSONB", apply: convertPayloads(AggregateEventsTable)},
+	Migration{Version: 7, Description: "Store payload content types", apply: addPayloadContentTypes(AggregateEventsTable)},
+)
+
+var tablePerStreamMigrations = []Migration{
+	{Version: 1, Description: "Index EventStream metadata", apply: indexStreamMetadata},
+	{Version: 2, Description: "Add global position to EventStream Tables", apply: addStreamTablePositions},
+	{Version: 3, Description: "Track EventStream truncation", apply: addStreamTruncation},
+	{Version: 4, Description: "Soft delete EventStreams", apply: addStreamDeletion},
+	{Version: 5, Description: "Store EventStream partitioning", apply: addStreamPartitioning},
+	{Version: 6, Description: "Store payloads as JSONB", apply: convertStreamTablePayloads},
+	{Version: 7, Description: "Store payload content types", apply: addStreamTablePayloadContentTypes},
+}
+
+// Migrate applies all pending Migrations in one transaction
+// Concurrent calls are serialized by an advisory lock, so each Migration is applied exactly once
+// EventStore.Install migrates after creating the EventStore Tables
+func (sr streamRegistry) Migrate(ctx context.Context) error {
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, sr.table(MigrationsTable))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			strategy VARCHAR(50) NOT NULL,
+			version INTEGER NOT NULL,
+			description VARCHAR(150) NOT NULL,
+			applied_at TIMESTAMP(6) NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (strategy, version)
+		);`, sr.table(MigrationsTable)))
+	if err != nil {
+		return err
+	}
+
+	err = sr.addMigrationStrategies(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	pending, err := sr.pendingMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		err = migration.apply(ctx, sr.config, tx)
+		if err != nil {
+			return fmt.Errorf("Failed to apply Migration %d: %s", migration.Version, err.Error())
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (strategy, version, description) VALUES ($1, $2, $3)`, sr.table(MigrationsTable)), sr.strategy, migration.Version, migration.Description)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PendingMigrations returns the Migrations not yet applied by Migrate in order of their Version
+func (sr streamRegistry) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	exists, err := sr.tableExists(ctx, sr.db, MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		exists, err = sr.columnExists(ctx, sr.db, MigrationsTable, "strategy")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !exists {
+		return append([]Migration{}, sr.migrations...), nil
+	}
+
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	return sr.pendingMigrations(ctx, tx)
+}
+
+func (sr streamRegistry) pendingMigrations(ctx context.Context, tx pgx.Tx) ([]Migration, error) {
+	applied := map[int]bool{}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT version FROM %s WHERE strategy = $1`, sr.table(MigrationsTable)), sr.strategy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	pending := []Migration{}
+
+	for _, migration := range sr.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// addMigrationStrategies keys a ledger created before the strategy column by strategy and version
+// The existing rows can not be attributed to a strategy and are kept with an empty one,
+// all Migrations are idempotent, so each strategy simply applies them again
+func (sr streamRegistry) addMigrationStrategies(ctx context.Context, tx pgx.Tx) error {
+	exists, err := sr.columnExists(ctx, tx, MigrationsTable, "strategy")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		ALTER TABLE %s
+			ADD COLUMN strategy VARCHAR(50) NOT NULL DEFAULT '',
+			DROP CONSTRAINT %s,
+			ADD PRIMARY KEY (strategy, version);`, sr.table(MigrationsTable), pgx.Identifier{sr.prefix + MigrationsTable + "_pkey"}.Sanitize()))
+
+	return err
+}
+
+func indexStreamMetadata(ctx context.Context, c config, tx pgx.Tx) error {
+	return c.createStreamMetadataIndex(ctx, tx)
+}
+
+// addStreamTablePositions adds the global position to EventStream Tables created before it was introduced
+// Existing Events are positioned per EventStream in order of their number
+func addStreamTablePositions(ctx context.Context, c config, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s;`, c.table(PositionSequence)))
+	if err != nil {
+		return err
+	}
+
+	tableNames, err := fetchStreamTableNames(ctx, c, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tableNames {
+		exists, err := c.columnExists(ctx, tx, name, "position")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		tableName := c.table(name)
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN position BIGINT;`, tableName))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			UPDATE %[1]s SET position = positions.position FROM (
+				SELECT no, nextval('%[2]s') AS position FROM (SELECT no FROM %[1]s ORDER BY no) AS events
+			) AS positions WHERE %[1]s.no = positions.no;`, tableName, c.table(PositionSequence)))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			ALTER TABLE %s
+				ALTER COLUMN position SET DEFAULT nextval('%s'),
+				ALTER COLUMN position SET NOT NULL,
+				ADD UNIQUE (position);`, tableName, c.table(PositionSequence)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addStreamTruncation(ctx context.Context, c config, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS truncated_before BIGINT NOT NULL DEFAULT 0;`, c.table(EventStreamsTable)))
+
+	return err
+}
+
+func addStreamDeletion(ctx context.Context, c config, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(6);`, c.table(EventStreamsTable)))
+
+	return err
+}
+
+func addStreamPartitioning(ctx context.Context, c config, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS partitioning JSONB;`, c.table(EventStreamsTable)))
+
+	return err
+}
+
+// convertPayloads converts the payload of the events Table, the archive Tables and the outbox from JSON to JSONB
+func convertPayloads(eventsTable string) func(ctx context.Context, c config, tx pgx.Tx) error {
+	return func(ctx context.Context, c config, tx pgx.Tx) error {
+		tableNames, err := fetchStreamTableNames(ctx, c, tx)
+		if err != nil {
+			return err
+		}
+
+		return convertPayloadColumns(ctx, c, tx, append(archiveTableNames(tableNames), eventsTable, OutboxTable))
+	}
+}
+
+// convertStreamTablePayloads converts the payload of all EventStream Tables, their archive Tables and the outbox from JSON to JSONB
+func convertStreamTablePayloads(ctx context.Context, c config, tx pgx.Tx) error {
+	tableNames, err := fetchStreamTableNames(ctx, c, tx)
+	if err != nil {
+		return err
+	}
+
+	return convertPayloadColumns(ctx, c, tx, append(append(tableNames, archiveTableNames(tableNames)...), OutboxTable))
+}
+
+func convertPayloadColumns(ctx context.Context, c config, tx pgx.Tx, tableNames []string) error {
+	for _, name := range tableNames {
+		dataType, err := c.columnType(ctx, tx, name, "payload")
+		if err != nil {
+			return err
+		}
+		if dataType != "json" {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN payload TYPE JSONB USING payload::JSONB;`, c.table(name)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPayloadContentTypes adds the content type and binary payload of a Serializer to the events Table, its archive Tables and the outbox
+func addPayloadContentTypes(eventsTable string) func(ctx context.Context, c config, tx pgx.Tx) error {
+	return func(ctx context.Context, c config, tx pgx.Tx) error {
+		tableNames, err := fetchStreamTableNames(ctx, c, tx)
+		if err != nil {
+			return err
+		}
+
+		return addContentTypeColumns(ctx, c, tx, append(archiveTableNames(tableNames), eventsTable, OutboxTable))
+	}
+}
+
+// addStreamTablePayloadContentTypes adds the content type and binary payload of a Serializer to all EventStream Tables, their archive Tables and the outbox
+func addStreamTablePayloadContentTypes(ctx context.Context, c config, tx pgx.Tx) error {
+	tableNames, err := fetchStreamTableNames(ctx, c, tx)
+	if err != nil {
+		return err
+	}
+
+	return addContentTypeColumns(ctx, c, tx, append(append(tableNames, archiveTableNames(tableNames)...), OutboxTable))
+}
+
+// addContentTypeColumns adds the columns in the same order to EventStream Tables and their archives, so truncation can still archive with SELECT *
+// The payload_content_type constraint is dropped first, so a repeated migration replaces it instead of failing
+func addContentTypeColumns(ctx context.Context, c config, tx pgx.Tx, tableNames []string) error {
+	for _, name := range tableNames {
+		exists, err := c.tableExists(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			ALTER TABLE %s
+				ALTER COLUMN payload DROP NOT NULL,
+				ADD COLUMN IF NOT EXISTS content_type VARCHAR(100) NOT NULL DEFAULT '%s',
+				ADD COLUMN IF NOT EXISTS payload_bytes BYTEA,
+				DROP CONSTRAINT IF EXISTS payload_content_type,
+				ADD %s;`, c.table(name), JSONContentType, payloadContentTypeCheck))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addEventNumbers adds the per EventStream number to the events Table and its archive Tables
+// Existing Events keep their global number as number, so stored numbers and truncation points stay valid and new Events continue after them
+func addEventNumbers(ctx context.Context, c config, tx pgx.Tx) error {
+	tableNames, err := fetchStreamTableNames(ctx, c, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range append([]string{EventsTable}, archiveTableNames(tableNames)...) {
+		exists, err := c.tableExists(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS version BIGINT;`, c.table(name)))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET version = no WHERE version IS NULL;`, c.table(name)))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN version SET NOT NULL;`, c.table(name)))
+		if err != nil {
+			return err
+		}
+
+		if name == EventsTable {
+			err = c.createEventNumberIndex(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func archiveTableNames(tableNames []string) []string {
+	archives := make([]string, 0, len(tableNames))
+
+	for _, name := range tableNames {
+		archives = append(archives, name+"_archive")
+	}
+
+	return archives
+}
+
+func fetchStreamTableNames(ctx context.Context, c config, tx pgx.Tx) ([]string, error) {
+	tableNames := []string{}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT stream_name FROM %s ORDER BY no`, c.table(EventStreamsTable)))
+	if err != nil {
+		return tableNames, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return tableNames, err
+		}
+
+		tableNames = append(tableNames, name)
+	}
+
+	return tableNames, rows.Err()
+}
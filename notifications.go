@@ -0,0 +1,96 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Notification is emitted after new Events were committed to an EventStream
+// No is the number of the last appended Event
+type Notification struct {
+	Stream string `json:"stream"`
+	No     int    `json:"no"`
+}
+
+// Subscription delivers Notifications for the subscribed EventStreams on C
+// C is closed when the context is done or the listening connection fails, Err returns the cause afterwards
+type Subscription struct {
+	C   <-chan Notification
+	err error
+}
+
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Subscribe listens on a dedicated connection for Notifications of the given EventStreams
+// Notifications are only emitted by PersistenceStrategies created with WithNotifications
+func (sr streamRegistry) Subscribe(ctx context.Context, streams ...string) (*Subscription, error) {
+	conn, err := sr.db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		_, err = conn.Exec(ctx, `LISTEN `+pgx.Identifier{sr.channel(stream)}.Sanitize())
+		if err != nil {
+			conn.Release()
+			return nil, err
+		}
+	}
+
+	notifications := make(chan Notification)
+	subscription := &Subscription{C: notifications}
+
+	go func() {
+		defer close(notifications)
+		defer func() {
+			if !conn.Conn().IsClosed() {
+				conn.Exec(context.Background(), `UNLISTEN *`)
+			}
+
+			conn.Release()
+		}()
+
+		for {
+			n, err := conn.Conn().WaitForNotification(ctx)
+			if err != nil {
+				subscription.err = err
+				return
+			}
+
+			var notification Notification
+
+			err = json.Unmarshal([]byte(n.Payload), &notification)
+			if err != nil {
+				subscription.err = err
+				return
+			}
+
+			select {
+			case notifications <- notification:
+			case <-ctx.Done():
+				subscription.err = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return subscription, nil
+}
+
+// channel returns the notification channel of the EventStream
+// It is hashed from the qualified Table name of the EventStream, so it stays distinct per schema and prefix within the identifier length of Postgres
+func (c config) channel(streamName string) string {
+	return GenerateTableName(c.table(GenerateTableName(streamName)))
+}
+
+func (c config) queueNotification(batch *pgx.Batch, streamName, headQuery string, arguments ...interface{}) {
+	batch.Queue(
+		fmt.Sprintf(`SELECT pg_notify($1, json_build_object('stream', $2::TEXT, 'no', (%s))::TEXT)`, headQuery),
+		append([]interface{}{c.channel(streamName), streamName}, arguments...)...,
+	)
+}
@@ -0,0 +1,165 @@
+package pg
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type Option func(*config)
+
+type config struct {
+	schema           string
+	prefix           string
+	notify           bool
+	streaming        bool
+	outbox           bool
+	idempotent       bool
+	upcasters        *Upcasters
+	orderedPositions bool
+	serializers      []Serializer
+}
+
+// WithSchema places all EventStore Tables in the given Postgres Schema instead of the current search_path
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// WithTablePrefix prefixes all EventStore Tables, including the generated EventStream Tables
+func WithTablePrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// WithNotifications emits a Notification on the channel of the EventStream for each committed AppendTo
+// Notifications can be received with Subscribe
+func WithNotifications() Option {
+	return func(c *config) {
+		c.notify = true
+	}
+}
+
+// WithStreamingIterator keeps only the current page of Events in memory while iterating a loaded EventStream
+// A Rewind of such an iterator queries the EventStream again
+func WithStreamingIterator() Option {
+	return func(c *config) {
+		c.streaming = true
+	}
+}
+
+// WithOutbox writes each appended Event to the outbox Table in the same transaction
+// The outbox is published by an OutboxRelay
+func WithOutbox() Option {
+	return func(c *config) {
+		c.outbox = true
+	}
+}
+
+// WithIdempotentAppends makes a retried AppendTo a no-op if all of its Events were already appended in the same order
+// If only some of the Events were appended before, AppendTo returns an IdempotencyViolation
+func WithIdempotentAppends() Option {
+	return func(c *config) {
+		c.idempotent = true
+	}
+}
+
+// WithUpcasters passes all loaded Events through the Upcasters before their payload is decoded
+// Appended Events are stamped with the current schema version of their name
+func WithUpcasters(upcasters *Upcasters) Option {
+	return func(c *config) {
+		c.upcasters = upcasters
+	}
+}
+
+// WithSerializers encodes the payloads of appended Events with the first Serializer instead of JSON
+// All Serializers and the JSONSerializer decode loaded Events by their stored content type, so EventStreams can mix encodings
+func WithSerializers(serializers ...Serializer) Option {
+	return func(c *config) {
+		c.serializers = serializers
+	}
+}
+
+// WithOrderedPositions serializes the appends to all EventStreams, so global positions become visible in increasing order
+// It is required by consumers reading multiple EventStreams from a position like MergeAndLoadFromPosition or projections,
+// without it only the appends to the same EventStream are serialized
+func WithOrderedPositions() Option {
+	return func(c *config) {
+		c.orderedPositions = true
+	}
+}
+
+func (c config) table(name string) string {
+	return c.identifier(name).Sanitize()
+}
+
+func (c config) identifier(name string) pgx.Identifier {
+	if c.schema == "" {
+		return pgx.Identifier{c.prefix + name}
+	}
+
+	return pgx.Identifier{c.schema, c.prefix + name}
+}
+
+func (c config) createSchema(ctx context.Context, db execer) error {
+	if c.schema == "" {
+		return nil
+	}
+
+	_, err := db.Exec(ctx, `CREATE SCHEMA IF NOT EXISTS `+pgx.Identifier{c.schema}.Sanitize())
+
+	return err
+}
+
+func (c config) tableExists(ctx context.Context, db queryer, name string) (bool, error) {
+	var exists bool
+
+	err := db.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_tables WHERE schemaname = COALESCE(NULLIF($1, ''), current_schema()) AND tablename = $2)`,
+		c.schema,
+		c.prefix+name,
+	).Scan(&exists)
+
+	return exists, err
+}
+
+func (c config) columnExists(ctx context.Context, db queryer, tableName, column string) (bool, error) {
+	var exists bool
+
+	err := db.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2 AND column_name = $3)`,
+		c.schema,
+		c.prefix+tableName,
+		column,
+	).Scan(&exists)
+
+	return exists, err
+}
+
+func (c config) columnType(ctx context.Context, db queryer, tableName, column string) (string, error) {
+	var dataType string
+
+	err := db.QueryRow(
+		ctx,
+		`SELECT COALESCE(MAX(data_type), '') FROM information_schema.columns WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2 AND column_name = $3`,
+		c.schema,
+		c.prefix+tableName,
+		column,
+	).Scan(&dataType)
+
+	return dataType, err
+}
+
+func newConfig(options []Option) config {
+	c := config{}
+
+	for _, option := range options {
+		option(&c)
+	}
+
+	return c
+}
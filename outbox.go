@@ -0,0 +1,305 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+	uuid "github.com/satori/go.uuid"
+)
+
+const OutboxTable = "outbox"
+
+// OutboxMessage is an Event written to the outbox together with its EventStream
+type OutboxMessage struct {
+	ID        int
+	Stream    string
+	EventID   uuid.UUID
+	EventName string
+	// Payload is encoded with the Serializer of the ContentType, by default JSONContentType
+	Payload     []byte
+	ContentType string
+	Metadata    map[string]interface{}
+	CreatedAt   time.Time
+	// Attempts is the number of failed publish attempts before the current one
+	Attempts int
+}
+
+// Publisher delivers OutboxMessages to other services
+// Messages are delivered at least once, so Publish has to be idempotent on the EventID
+type Publisher interface {
+	Publish(ctx context.Context, message OutboxMessage) error
+}
+
+// OutboxRelay publishes the OutboxMessages written by PersistenceStrategies created with WithOutbox
+// Multiple relays can run concurrently, each message is claimed by one relay at a time
+type OutboxRelay struct {
+	config
+	db        *pgxpool.Pool
+	publisher Publisher
+	// BatchSize is the maximum number of messages claimed by one Dispatch
+	BatchSize int
+	// MaxAttempts is the number of failed publish attempts after which a message is no longer retried
+	MaxAttempts int
+	// RetryDelay is multiplied by the number of failed attempts to delay the next attempt of a message
+	RetryDelay time.Duration
+}
+
+// Dispatch claims the next batch of due messages, publishes them and returns the number of published messages
+// The messages of each EventStream are claimed in order from its oldest undispatched message up to the first message
+// which is not due or claimed by another relay, so a failed message blocks the following messages of its EventStream
+// until it is published, also across concurrent relays. A message failing MaxAttempts times blocks its EventStream
+// until it is requeued, see DeadLetters and Requeue
+func (r OutboxRelay) Dispatch(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	messages, err := r.claimMessages(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	failedStreams := map[string]bool{}
+
+	for _, message := range messages {
+		if failedStreams[message.Stream] {
+			continue
+		}
+
+		err = r.publisher.Publish(ctx, message)
+		if err != nil {
+			failedStreams[message.Stream] = true
+
+			_, err = tx.Exec(
+				ctx,
+				fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2 WHERE id = $3`, r.table(OutboxTable)),
+				err.Error(),
+				time.Now().Add(r.RetryDelay*time.Duration(message.Attempts+1)),
+				message.ID,
+			)
+			if err != nil {
+				return published, err
+			}
+
+			continue
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dispatched_at = $1 WHERE id = $2`, r.table(OutboxTable)), time.Now(), message.ID)
+		if err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	return published, tx.Commit(ctx)
+}
+
+// Run dispatches messages until the context is done, it waits for interval whenever no message was published
+func (r OutboxRelay) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		published, err := r.Dispatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		if published > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeadLetters returns the undispatched messages which failed MaxAttempts times, each of them blocks its EventStream
+// Attempts and the last error explain the failure, the message is only published again after Requeue
+func (r OutboxRelay) DeadLetters(ctx context.Context) ([]OutboxMessage, error) {
+	rows, err := r.db.Query(
+		ctx,
+		fmt.Sprintf(`SELECT %s FROM %s WHERE dispatched_at IS NULL AND attempts >= $1 ORDER BY id`, outboxMessageColumns, r.table(OutboxTable)),
+		r.MaxAttempts,
+	)
+	if err != nil {
+		return []OutboxMessage{}, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+// Requeue resets the attempts of a dead letter, so the next Dispatch publishes it and unblocks its EventStream
+func (r OutboxRelay) Requeue(ctx context.Context, id int) error {
+	_, err := r.db.Exec(
+		ctx,
+		fmt.Sprintf(`UPDATE %s SET attempts = 0, next_attempt_at = NOW() WHERE id = $1 AND dispatched_at IS NULL`, r.table(OutboxTable)),
+		id,
+	)
+
+	return err
+}
+
+const outboxMessageColumns = `id, stream_name, event_id, event_name, COALESCE(payload_bytes, convert_to(payload::TEXT, 'UTF8')), content_type, metadata, created_at, attempts`
+
+// claimMessages locks the leading due messages of each EventStream, n numbers the undispatched messages per EventStream
+// Messages locked by another relay are skipped by Postgres, so only messages without such a gap before them are returned
+func (r OutboxRelay) claimMessages(ctx context.Context, tx pgx.Tx) ([]OutboxMessage, error) {
+	rows, err := tx.Query(
+		ctx,
+		fmt.Sprintf(`
+			WITH pending AS (
+				SELECT id AS claimed_id,
+					ROW_NUMBER() OVER (PARTITION BY stream_name ORDER BY id) AS n,
+					BOOL_AND(attempts < $1 AND next_attempt_at <= $2) OVER (PARTITION BY stream_name ORDER BY id) AS due
+				FROM %[2]s WHERE dispatched_at IS NULL
+			), claimed AS (
+				SELECT claimed_id, n FROM pending WHERE due ORDER BY claimed_id LIMIT %[3]d
+			)
+			SELECT %[1]s, claimed.n FROM %[2]s AS outbox JOIN claimed ON claimed.claimed_id = outbox.id
+			WHERE outbox.dispatched_at IS NULL
+			ORDER BY outbox.id FOR UPDATE OF outbox SKIP LOCKED`, outboxMessageColumns, r.table(OutboxTable), r.BatchSize),
+		r.MaxAttempts,
+		time.Now(),
+	)
+	if err != nil {
+		return []OutboxMessage{}, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+	claimed := map[string]int{}
+
+	for rows.Next() {
+		var n int
+
+		message, err := scanOutboxMessage(rows, &n)
+		if err != nil {
+			return messages, err
+		}
+		if n != claimed[message.Stream]+1 {
+			continue
+		}
+
+		claimed[message.Stream] = n
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func scanOutboxMessages(rows pgx.Rows) ([]OutboxMessage, error) {
+	messages := []OutboxMessage{}
+
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// scanOutboxMessage scans the outboxMessageColumns of the current row followed by the extra columns
+func scanOutboxMessage(rows pgx.Rows, extra ...interface{}) (OutboxMessage, error) {
+	var message OutboxMessage
+	var eventID string
+	var payload []byte
+
+	err := rows.Scan(append([]interface{}{&message.ID, &message.Stream, &eventID, &message.EventName, &payload, &message.ContentType, &message.Metadata, &message.CreatedAt, &message.Attempts}, extra...)...)
+	if err != nil {
+		return message, err
+	}
+
+	message.EventID = uuid.FromStringOrNil(eventID)
+	message.Payload = payload
+
+	return message, nil
+}
+
+func (c config) createOutboxTable(ctx context.Context, db *pgxpool.Pool) error {
+	exists, err := c.tableExists(ctx, db, OutboxTable)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+	_, err = db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			id BIGSERIAL,
+			stream_name VARCHAR(150) NOT NULL,
+			event_id UUID NOT NULL,
+			event_name VARCHAR(100) NOT NULL,
+			payload JSONB,
+			metadata JSONB NOT NULL,
+			created_at TIMESTAMP(6) NOT NULL,
+			content_type VARCHAR(100) NOT NULL DEFAULT 'application/json',
+			payload_bytes BYTEA,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at TIMESTAMP(6) NOT NULL DEFAULT NOW(),
+			dispatched_at TIMESTAMP(6),
+			PRIMARY KEY (id),
+			%s
+		);`, c.table(OutboxTable), payloadContentTypeCheck))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, fmt.Sprintf(`CREATE INDEX ON %s (id) WHERE dispatched_at IS NULL;`, c.table(OutboxTable)))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, fmt.Sprintf(`CREATE INDEX ON %s (stream_name, id) WHERE dispatched_at IS NULL;`, c.table(OutboxTable)))
+
+	return err
+}
+
+func (c config) queueOutboxMessage(batch *pgx.Batch, streamName string, event eventstore.DomainEvent, payload serializedPayload) {
+	batch.Queue(
+		fmt.Sprintf(`INSERT INTO %s (stream_name, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`, c.table(OutboxTable)),
+		streamName,
+		event.UUID().String(),
+		event.Name(),
+		payload.payload,
+		payload.bytes,
+		payload.contentType,
+		c.eventMetadata(event),
+		event.CreatedAt(),
+	)
+}
+
+// queueOutboxCopy writes the Events selected by fromClause to the outbox, $1 is the stream name and the arguments start at $2
+func (c config) queueOutboxCopy(batch *pgx.Batch, streamName, fromClause string, arguments ...interface{}) {
+	batch.Queue(
+		fmt.Sprintf(`INSERT INTO %s (stream_name, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) SELECT $1, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at %s`, c.table(OutboxTable), fromClause),
+		append([]interface{}{streamName}, arguments...)...,
+	)
+}
+
+// NewOutboxRelay creates an OutboxRelay, the options have to match the ones of the PersistenceStrategy writing the outbox
+func NewOutboxRelay(db *pgxpool.Pool, publisher Publisher, options ...Option) *OutboxRelay {
+	return &OutboxRelay{
+		config:      newConfig(options),
+		db:          db,
+		publisher:   publisher,
+		BatchSize:   100,
+		MaxAttempts: 10,
+		RetryDelay:  time.Second,
+	}
+}
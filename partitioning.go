@@ -0,0 +1,551 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	PartitionedByMonth  = "month"
+	PartitionedByNumber = "number"
+)
+
+// Partitioning describes how the Table of a partitioned EventStream is split into Postgres partitions
+// Events outside of all partitions are kept in a default partition until MaintainPartitions moves them
+type Partitioning struct {
+	By string `json:"by"`
+	// Size is the number of Events per partition, only used by PartitionedByNumber
+	Size int `json:"size,omitempty"`
+	// Ahead is the number of partitions created ahead of the current one
+	Ahead int `json:"ahead"`
+}
+
+// PartitionByMonth partitions the Events by the month of their creation
+func PartitionByMonth(ahead int) Partitioning {
+	return Partitioning{By: PartitionedByMonth, Ahead: ahead}
+}
+
+// PartitionByNumber partitions the Events in ranges of size numbers
+func PartitionByNumber(size, ahead int) Partitioning {
+	return Partitioning{By: PartitionedByNumber, Size: size, Ahead: ahead}
+}
+
+func (p Partitioning) column() string {
+	if p.By == PartitionedByMonth {
+		return "created_at"
+	}
+
+	return "no"
+}
+
+func (p Partitioning) monthRange(month time.Time) partitionRange {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	return partitionRange{
+		suffix: from.Format("p200601"),
+		from:   from.Format("'2006-01-02 15:04:05'"),
+		to:     to.Format("'2006-01-02 15:04:05'"),
+	}
+}
+
+func (p Partitioning) numberRange(index int) partitionRange {
+	return partitionRange{
+		suffix: fmt.Sprintf("p%010d", index),
+		from:   strconv.Itoa(index*p.Size + 1),
+		to:     strconv.Itoa((index+1)*p.Size + 1),
+	}
+}
+
+// Partition is an attached partition of a partitioned EventStream, Bound is its Postgres partition bound
+type Partition struct {
+	Name  string
+	Bound string
+}
+
+// partitionRange holds the SQL literals of the bounds of a partition
+type partitionRange struct {
+	suffix string
+	from   string
+	to     string
+}
+
+// maxIdentifierLength is the number of bytes Postgres keeps of an identifier, longer identifiers are truncated
+const maxIdentifierLength = 63
+
+// partitionTableName returns the name of a partition of the EventStream without schema and prefix
+// It is shorter than the Table name of the EventStream, so partition names stay distinct within the identifier length of Postgres
+func partitionTableName(streamName, suffix string) string {
+	return GenerateTableName(streamName)[:21] + "_" + suffix
+}
+
+type rowsQueryer interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// CreatePartitionedStream creates a new EventStream whose Table is partitioned by range, partitions up to Ahead are created immediately
+// Load and AppendTo use a partitioned EventStream like any other, Postgres only enforces unique indexes per partition,
+// so appends check event ids and Aggregate versions across all partitions under the append lock
+func (ps PersistenceStrategy) CreatePartitionedStream(ctx context.Context, streamName string, partitioning Partitioning) error {
+	if partitioning.By != PartitionedByMonth && (partitioning.By != PartitionedByNumber || partitioning.Size <= 0) {
+		return errors.New("Invalid Partitioning, use PartitionByMonth or PartitionByNumber with a positive size")
+	}
+	if len(ps.prefix+partitionTableName(streamName, partitioning.numberRange(0).suffix)) > maxIdentifierLength {
+		return fmt.Errorf("The table prefix %s is too long for the partitions of Stream %s", ps.prefix, streamName)
+	}
+
+	err := ps.createStream(ctx, streamName, map[string]interface{}{}, func(ctx context.Context, streamName string) error {
+		return ps.createPartitionedSchema(ctx, streamName, partitioning)
+	})
+	if err != nil {
+		return err
+	}
+
+	return ps.maintainPartitions(ctx, streamName, partitioning)
+}
+
+func (ps PersistenceStrategy) createPartitionedSchema(ctx context.Context, streamName string, partitioning Partitioning) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	name := GenerateTableName(streamName)
+	primaryKey := "no"
+
+	if partitioning.column() != "no" {
+		primaryKey = "no, " + partitioning.column()
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s,
+			PRIMARY KEY (%s)
+		) PARTITION BY RANGE (%s);`, ps.table(name), ps.streamTableColumns(), primaryKey, partitioning.column()))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s DEFAULT`, ps.table(partitionTableName(streamName, "default")), ps.table(name)))
+	if err != nil {
+		return err
+	}
+
+	err = createPartitionIndexes(ctx, tx, ps.table(partitionTableName(streamName, "default")))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET partitioning = $1 WHERE real_stream_name = $2`, ps.table(EventStreamsTable)), partitioning, streamName)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MaintainPartitions creates the partitions ahead of the current one for all partitioned EventStreams
+// and moves Events from the default partitions into new partitions of their range
+func (ps PersistenceStrategy) MaintainPartitions(ctx context.Context) error {
+	streams := map[string]Partitioning{}
+	names := []string{}
+
+	rows, err := ps.db.Query(ctx, fmt.Sprintf(`SELECT real_stream_name, partitioning FROM %s WHERE partitioning IS NOT NULL ORDER BY no`, ps.table(EventStreamsTable)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var partitioning Partitioning
+
+		err = rows.Scan(&name, &partitioning)
+		if err != nil {
+			return err
+		}
+
+		streams[name] = partitioning
+		names = append(names, name)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	rows.Close()
+
+	for _, name := range names {
+		err = ps.maintainPartitions(ctx, name, streams[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunPartitionMaintenance calls MaintainPartitions every interval until the context is done
+func (ps PersistenceStrategy) RunPartitionMaintenance(ctx context.Context, interval time.Duration) error {
+	for {
+		err := ps.MaintainPartitions(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// StreamPartitions returns the attached partitions of the EventStream ordered by their range, followed by its default partition
+func (ps PersistenceStrategy) StreamPartitions(ctx context.Context, streamName string) ([]Partition, error) {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.fetchPartitions(ctx, ps.db, streamName)
+}
+
+// DetachPartition detaches the partition from the EventStream and keeps it as a standalone Table, for example to archive it
+// Only the oldest partition can be detached and only if no remaining Event is older, so the EventStream stays without gaps
+// Events of a detached partition are no longer loaded, the truncation point of the EventStream is raised behind its newest detached Event
+func (ps PersistenceStrategy) DetachPartition(ctx context.Context, streamName, partition string) error {
+	return ps.detachPartition(ctx, streamName, partition, false)
+}
+
+// DropPartition detaches the oldest partition from the EventStream and drops it with all its Events
+func (ps PersistenceStrategy) DropPartition(ctx context.Context, streamName, partition string) error {
+	return ps.detachPartition(ctx, streamName, partition, true)
+}
+
+func (ps PersistenceStrategy) detachPartition(ctx context.Context, streamName, partition string, drop bool) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := ps.fetchPartitions(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	found := -1
+
+	for i, p := range partitions {
+		if p.Name != partition {
+			continue
+		}
+		if p.Bound == "DEFAULT" {
+			return fmt.Errorf("The default Partition of Stream %s can not be detached", streamName)
+		}
+
+		found = i
+	}
+	if found < 0 {
+		return PartitionNotFound{Stream: streamName, Partition: partition}
+	}
+	if found > 0 {
+		return fmt.Errorf("Partition %s of Stream %s can not be detached before the older Partition %s", partition, streamName, partitions[0].Name)
+	}
+
+	tableName := ps.table(GenerateTableName(streamName))
+	partitionName := ps.table(strings.TrimPrefix(partition, ps.prefix))
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`, tableName, partitionName))
+	if err != nil {
+		return err
+	}
+
+	var detachedBefore int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(no), 0) + 1 FROM %s`, partitionName)).Scan(&detachedBefore)
+	if err != nil {
+		return err
+	}
+
+	var gap bool
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE no < $1)`, tableName), detachedBefore).Scan(&gap)
+	if err != nil {
+		return err
+	}
+	if gap {
+		return fmt.Errorf("Partition %s of Stream %s can not be detached before older Events of the remaining Partitions", partition, streamName)
+	}
+
+	if drop {
+		_, err = tx.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, partitionName))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		fmt.Sprintf(`UPDATE %s SET truncated_before = GREATEST(truncated_before, $1) WHERE real_stream_name = $2`, ps.table(EventStreamsTable)),
+		detachedBefore,
+		streamName,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// maintainPartitions attaches all missing partitions of the EventStream up to Ahead and for the Events in its default partition
+func (ps PersistenceStrategy) maintainPartitions(ctx context.Context, streamName string, partitioning Partitioning) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	ranges, err := ps.duePartitionRanges(ctx, tx, streamName, partitioning)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := ps.fetchPartitions(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	attached := map[string]bool{}
+
+	for _, p := range partitions {
+		attached[p.Name] = true
+	}
+
+	for _, r := range ranges {
+		name := ps.prefix + partitionTableName(streamName, r.suffix)
+		if attached[name] {
+			continue
+		}
+
+		err = ps.attachPartition(ctx, tx, streamName, partitioning, r)
+		if err != nil {
+			return err
+		}
+
+		attached[name] = true
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (ps PersistenceStrategy) duePartitionRanges(ctx context.Context, tx pgx.Tx, streamName string, partitioning Partitioning) ([]partitionRange, error) {
+	name := GenerateTableName(streamName)
+	ranges := []partitionRange{}
+
+	if partitioning.By == PartitionedByMonth {
+		rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT DISTINCT date_trunc('month', created_at) FROM %s`, ps.table(partitionTableName(streamName, "default"))))
+		if err != nil {
+			return ranges, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var month time.Time
+
+			err = rows.Scan(&month)
+			if err != nil {
+				return ranges, err
+			}
+
+			ranges = append(ranges, partitioning.monthRange(month))
+		}
+		if rows.Err() != nil {
+			return ranges, rows.Err()
+		}
+
+		now := time.Now()
+
+		for i := 0; i <= partitioning.Ahead; i++ {
+			ranges = append(ranges, partitioning.monthRange(time.Date(now.Year(), now.Month()+time.Month(i), 1, 0, 0, 0, 0, time.UTC)))
+		}
+
+		return ranges, nil
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT DISTINCT (no - 1) / $1 FROM %s`, ps.table(partitionTableName(streamName, "default"))), partitioning.Size)
+	if err != nil {
+		return ranges, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index int
+
+		err = rows.Scan(&index)
+		if err != nil {
+			return ranges, err
+		}
+
+		ranges = append(ranges, partitioning.numberRange(index))
+	}
+	if rows.Err() != nil {
+		return ranges, rows.Err()
+	}
+	rows.Close()
+
+	var head int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(no), 0) FROM %s`, ps.table(name))).Scan(&head)
+	if err != nil {
+		return ranges, err
+	}
+
+	current := 0
+	if head > 0 {
+		current = (head - 1) / partitioning.Size
+	}
+
+	for i := 0; i <= partitioning.Ahead; i++ {
+		ranges = append(ranges, partitioning.numberRange(current+i))
+	}
+
+	return ranges, nil
+}
+
+// attachPartition creates the partition as standalone Table, moves its Events out of the default partition and attaches it
+func (ps PersistenceStrategy) attachPartition(ctx context.Context, tx pgx.Tx, streamName string, partitioning Partitioning, r partitionRange) error {
+	name := GenerateTableName(streamName)
+	tableName := ps.table(name)
+	partitionName := ps.table(partitionTableName(streamName, r.suffix))
+	condition := fmt.Sprintf(`%[1]s >= %[2]s AND %[1]s < %[3]s`, partitioning.column(), r.from, r.to)
+
+	_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, partitionName, tableName))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(
+		`WITH moved AS (DELETE FROM %s WHERE %s RETURNING *) INSERT INTO %s SELECT * FROM moved`,
+		ps.table(partitionTableName(streamName, "default")),
+		condition,
+		partitionName,
+	))
+	if err != nil {
+		return err
+	}
+
+	err = createPartitionIndexes(ctx, tx, partitionName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)`, tableName, partitionName, r.from, r.to))
+
+	return err
+}
+
+func (ps PersistenceStrategy) fetchPartitions(ctx context.Context, db rowsQueryer, streamName string) ([]Partition, error) {
+	partitions := []Partition{}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT c.relname, pg_get_expr(c.relpartbound, c.oid) FROM pg_catalog.pg_inherits i JOIN pg_catalog.pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = $1::regclass ORDER BY c.relispartition AND pg_get_expr(c.relpartbound, c.oid) = 'DEFAULT', c.relname`,
+		ps.table(GenerateTableName(streamName)),
+	)
+	if err != nil {
+		return partitions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Partition
+
+		err = rows.Scan(&p.Name, &p.Bound)
+		if err != nil {
+			return partitions, err
+		}
+
+		partitions = append(partitions, p)
+	}
+
+	return partitions, rows.Err()
+}
+
+// partitionedHead returns whether the EventStream is partitioned and the highest number of its Events
+func (ps PersistenceStrategy) partitionedHead(ctx context.Context, q queryer, streamName string) (partitioned bool, head int, err error) {
+	err = q.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT partitioning IS NOT NULL, (SELECT COALESCE(MAX(no), 0) FROM %s) FROM %s WHERE real_stream_name = $1`, ps.table(GenerateTableName(streamName)), ps.table(EventStreamsTable)),
+		streamName,
+	).Scan(&partitioned, &head)
+
+	return partitioned, head, err
+}
+
+// assertUniqueAcrossPartitions enforces the unique event ids and Aggregate versions for the Events appended after head
+// Postgres only enforces unique indexes per partition, so the caller has to hold the append lock of the EventStream
+// A duplicate is reported as unique violation like the unique indexes of an unpartitioned EventStream do
+func (ps PersistenceStrategy) assertUniqueAcrossPartitions(ctx context.Context, tx pgx.Tx, streamName string, head int) error {
+	tableName := ps.table(GenerateTableName(streamName))
+
+	var duplicateID, duplicateVersion bool
+
+	err := tx.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT
+			EXISTS (SELECT 1 FROM %[1]s a JOIN %[1]s p ON p.event_id = a.event_id AND p.no <> a.no WHERE a.no > $1),
+			EXISTS (
+				SELECT 1 FROM %[1]s a JOIN %[1]s p
+				ON p.metadata->>'_aggregate_type' = a.metadata->>'_aggregate_type'
+				AND p.metadata->>'_aggregate_id' = a.metadata->>'_aggregate_id'
+				AND p.metadata->>'_aggregate_version' = a.metadata->>'_aggregate_version'
+				AND p.no <> a.no
+				WHERE a.no > $1
+			)`, tableName),
+		head,
+	).Scan(&duplicateID, &duplicateVersion)
+	if err != nil {
+		return err
+	}
+
+	if duplicateID {
+		return &pgconn.PgError{Code: "23505", Message: fmt.Sprintf("duplicate event_id in partitions of Stream %s", streamName), TableName: GenerateTableName(streamName)}
+	}
+	if duplicateVersion {
+		return &pgconn.PgError{Code: "23505", Message: fmt.Sprintf("duplicate Aggregate version in partitions of Stream %s", streamName), TableName: GenerateTableName(streamName)}
+	}
+
+	return nil
+}
+
+func createPartitionIndexes(ctx context.Context, db execer, tableName string) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s (event_id);`, tableName))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s (position);`, tableName))
+	if err != nil {
+		return err
+	}
+
+	return createAggregateIndexes(ctx, db, tableName)
+}
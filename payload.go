@@ -0,0 +1,178 @@
+package pg
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// PayloadField filters Events by a field of their payload, nested fields are separated by dots like "customer.id"
+// EqualsOperator checks if the payload contains the field with the given value and can use the index of CreatePayloadGINIndex
+// The comparison operators, InOperator and NotInOperator compare the JSON values and can use the index of CreatePayloadIndex
+const PayloadField eventstore.FieldType = "payload"
+
+// payloadPath returns the field as Postgres text array literal to be used with the #> and #>> operators
+func payloadPath(field string) string {
+	keys := strings.Split(field, ".")
+
+	for i, key := range keys {
+		keys[i] = "'" + strings.ReplaceAll(key, "'", "''") + "'"
+	}
+
+	return fmt.Sprintf("ARRAY[%s]::TEXT[]", strings.Join(keys, ", "))
+}
+
+// payloadDocument nests the value into a JSON document along the field path, for a containment check with @>
+func payloadDocument(field string, value interface{}) map[string]interface{} {
+	keys := strings.Split(field, ".")
+	document := map[string]interface{}{keys[len(keys)-1]: value}
+
+	for i := len(keys) - 2; i >= 0; i-- {
+		document = map[string]interface{}{keys[i]: document}
+	}
+
+	return document
+}
+
+func payloadWhereClause(match eventstore.MetadataMatch, placeholder string) (string, interface{}, error) {
+	path := payloadPath(match.Field)
+
+	switch match.Operation {
+	case eventstore.EqualsOperator:
+		return fmt.Sprintf(`payload @> %s::JSONB`, placeholder), payloadDocument(match.Field, match.Value), nil
+	case eventstore.RegexOperator:
+		return fmt.Sprintf(`payload #>> %s ~ %s`, path, placeholder), match.Value, nil
+	case eventstore.InOperator, eventstore.NotInOperator:
+		value, err := json.Marshal(match.Value)
+		if err != nil {
+			return "", nil, err
+		}
+
+		operator := "IN"
+		if match.Operation == eventstore.NotInOperator {
+			operator = "NOT IN"
+		}
+
+		return fmt.Sprintf(`payload #> %s %s (SELECT jsonb_array_elements(%s::JSONB))`, path, operator, placeholder), value, nil
+	case eventstore.NotEqualsOperator:
+		value, err := json.Marshal(match.Value)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return fmt.Sprintf(`payload #> %s <> %s::JSONB`, path, placeholder), value, nil
+	default:
+		value, err := json.Marshal(match.Value)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return fmt.Sprintf(`payload #> %s %s %s::JSONB`, path, match.Operation, placeholder), value, nil
+	}
+}
+
+// payloadIndexName derives a fixed length index name from the Table and the definition of the index
+// Names derived from the prefixed Table name could exceed the 63 byte identifier limit, Postgres would truncate them
+// and CREATE INDEX IF NOT EXISTS would skip every further index with the same truncated name
+func payloadIndexName(tableName, definition string) string {
+	h := sha1.New()
+	h.Write([]byte(tableName + definition))
+
+	return "idx_" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// createPayloadIndex creates the index on the Table, condition makes it a partial index if not empty
+func (c config) createPayloadIndex(ctx context.Context, db execer, tableName, definition, condition string) error {
+	if condition != "" {
+		definition = definition + " WHERE " + condition
+	}
+
+	_, err := db.Exec(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s %s`, pgx.Identifier{payloadIndexName(tableName, definition)}.Sanitize(), tableName, definition))
+
+	return err
+}
+
+// payloadFieldIndex is the btree index definition on a payload field
+func payloadFieldIndex(field string) string {
+	return fmt.Sprintf(`((payload #> %s))`, payloadPath(field))
+}
+
+// payloadGINIndex is the GIN index definition on the whole payload
+const payloadGINIndex = `USING GIN (payload jsonb_path_ops)`
+
+// quoteLiteral quotes a value for a statement which does not accept parameters like the predicate of CREATE INDEX
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// CreatePayloadIndex creates a btree index on the payload field of the EventStream
+// It is used by PayloadField matchers with comparison operators, InOperator and NotInOperator
+func (ps PersistenceStrategy) CreatePayloadIndex(ctx context.Context, streamName, field string) error {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(GenerateTableName(streamName)), payloadFieldIndex(field), "")
+}
+
+// CreatePayloadGINIndex creates a GIN index on the payload of the EventStream
+// It is used by PayloadField matchers with EqualsOperator on any payload field
+func (ps PersistenceStrategy) CreatePayloadGINIndex(ctx context.Context, streamName string) error {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(GenerateTableName(streamName)), payloadGINIndex, "")
+}
+
+// CreatePayloadIndex creates a btree index on the payload field, partial on the Events of the EventStream
+// It is used by PayloadField matchers with comparison operators, InOperator and NotInOperator
+func (ps SingleTablePersistenceStrategy) CreatePayloadIndex(ctx context.Context, streamName, field string) error {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(EventsTable), payloadFieldIndex(field), "stream_name = "+quoteLiteral(streamName))
+}
+
+// CreatePayloadGINIndex creates a GIN index on the payload, partial on the Events of the EventStream
+// It is used by PayloadField matchers with EqualsOperator on any payload field
+func (ps SingleTablePersistenceStrategy) CreatePayloadGINIndex(ctx context.Context, streamName string) error {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(EventsTable), payloadGINIndex, "stream_name = "+quoteLiteral(streamName))
+}
+
+// CreatePayloadIndex creates a btree index on the payload field, partial on the Events of the EventStream
+// It is used by PayloadField matchers with comparison operators, InOperator and NotInOperator
+func (ps AggregateStreamPersistenceStrategy) CreatePayloadIndex(ctx context.Context, streamName, field string) error {
+	streamID, err := ps.fetchStreamID(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(AggregateEventsTable), payloadFieldIndex(field), fmt.Sprintf("stream_id = %d", streamID))
+}
+
+// CreatePayloadGINIndex creates a GIN index on the payload, partial on the Events of the EventStream
+// It is used by PayloadField matchers with EqualsOperator on any payload field
+func (ps AggregateStreamPersistenceStrategy) CreatePayloadGINIndex(ctx context.Context, streamName string) error {
+	streamID, err := ps.fetchStreamID(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.createPayloadIndex(ctx, ps.db, ps.table(AggregateEventsTable), payloadGINIndex, fmt.Sprintf("stream_id = %d", streamID))
+}
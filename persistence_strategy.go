@@ -7,12 +7,14 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	pgxpool "github.com/jackc/pgx/v4/pgxpool"
 
 	eventstore "github.com/go-event-store/eventstore"
+	uuid "github.com/satori/go.uuid"
 )
 
 const (
@@ -21,7 +23,15 @@ const (
 )
 
 type PersistenceStrategy struct {
-	db *pgxpool.Pool
+	streamRegistry
+}
+
+type queryer interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
 }
 
 func GenerateTableName(streamName string) string {
@@ -32,213 +42,492 @@ func GenerateTableName(streamName string) string {
 }
 
 func (ps PersistenceStrategy) CreateEventStreamsTable(ctx context.Context) error {
-	c, err := ps.db.Exec(ctx, `SELECT tablename FROM pg_catalog.pg_tables WHERE tablename = $1`, EventStreamsTable)
+	err := ps.streamRegistry.CreateEventStreamsTable(ctx)
 	if err != nil {
 		return err
 	}
 
-	if c.RowsAffected() == 1 {
-		return nil
-	}
-	_, err = ps.db.Exec(ctx, fmt.Sprintf(`
-		CREATE TABLE %s (
-			no BIGSERIAL,
-			real_stream_name VARCHAR(150) NOT NULL,
-			stream_name CHAR(41) NOT NULL,
-			metadata JSONB,
-			PRIMARY KEY (no),
-			UNIQUE (stream_name)
-		);`, EventStreamsTable))
+	_, err = ps.db.Exec(ctx, fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s;`, ps.table(PositionSequence)))
 
 	return err
 }
 
-func (ps PersistenceStrategy) CreateProjectionsTable(ctx context.Context) error {
-	c, err := ps.db.Exec(ctx, `SELECT tablename FROM pg_catalog.pg_tables WHERE tablename = $1`, ProjectionsTable)
+func (ps PersistenceStrategy) DeleteStream(ctx context.Context, streamName string) error {
+	err := ps.RemoveStreamFromStreamsTable(ctx, streamName)
 	if err != nil {
 		return err
 	}
-	if c.RowsAffected() == 1 {
-		return nil
-	}
-	_, err = ps.db.Exec(ctx, fmt.Sprintf(`
-		CREATE TABLE %s (
-            no BIGSERIAL,
-            name VARCHAR(150) NOT NULL,
-            position JSONB,
-            state JSONB,
-            status VARCHAR(28) NOT NULL,
-            locked_until TIMESTAMP(6),
-            PRIMARY KEY (no),
-            UNIQUE (name)
-		);`, ProjectionsTable))
 
-	return err
+	return ps.DropSchema(ctx, streamName)
 }
 
-func (ps PersistenceStrategy) AddStreamToStreamsTable(ctx context.Context, streamName string) error {
-	tableName := GenerateTableName(streamName)
-	_, err := ps.db.Exec(ctx, fmt.Sprintf(`INSERT INTO "%s" (real_stream_name, stream_name, metadata) VALUES ($1, $2, $3)`, EventStreamsTable), streamName, tableName, "{}")
-	if err != nil {
-		switch e := err.(type) {
-		case *pgconn.PgError:
-			if e.Code == "23505" || e.Code == "23000" {
-				return eventstore.StreamAlreadyExist{Stream: streamName}
-			}
-		default:
+// RenameStream renames the EventStream and its Table, including its partitions, in one transaction
+func (ps PersistenceStrategy) RenameStream(ctx context.Context, from, to string) error {
+	return ps.renameStream(ctx, from, to, func(ctx context.Context, tx pgx.Tx) error {
+		partitions, err := ps.fetchPartitions(ctx, tx, from)
+		if err != nil {
 			return err
 		}
-	}
-	return nil
+
+		for _, p := range partitions {
+			name := strings.TrimPrefix(p.Name, ps.prefix)
+			suffix := strings.TrimPrefix(name, partitionTableName(from, ""))
+
+			_, err = tx.Exec(ctx, fmt.Sprintf(
+				`ALTER TABLE %s RENAME TO %s`,
+				ps.table(name),
+				pgx.Identifier{ps.prefix + partitionTableName(to, suffix)}.Sanitize(),
+			))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, ps.table(GenerateTableName(from)), pgx.Identifier{ps.prefix + GenerateTableName(to)}.Sanitize()))
+
+		return err
+	})
 }
 
-func (ps PersistenceStrategy) RemoveStreamFromStreamsTable(ctx context.Context, streamName string) error {
-	c, err := ps.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE real_stream_name = $1`, EventStreamsTable), streamName)
-	if c.RowsAffected() == 0 {
-		return eventstore.StreamNotFound{Stream: streamName}
+// CopyStream creates the EventStream to with the metadata of from and a copy of the Events of from matching the matcher
+// Copied Events keep their order but get a new event_id and global position, it returns the number of copied Events
+func (ps PersistenceStrategy) CopyStream(ctx context.Context, from, to string, matcher eventstore.MetadataMatcher) (int64, error) {
+	query, values, err := ps.createQuery(ctx, from, 0, 0, 1, matcher)
+	if err != nil {
+		return 0, err
 	}
 
-	return err
-}
+	return ps.copyStream(ctx, from, to, ps.createSchema, func(ctx context.Context, tx pgx.Tx) (int64, error) {
+		c, err := tx.Exec(
+			ctx,
+			fmt.Sprintf(
+				`INSERT INTO %s (event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) SELECT %s, event_name, payload, payload_bytes, content_type, metadata, created_at FROM (%s) AS events ORDER BY no`,
+				ps.table(GenerateTableName(to)),
+				copiedEventID("event_id", "$1"),
+				query,
+			),
+			append([]interface{}{to}, values...)...,
+		)
 
-func (ps PersistenceStrategy) FetchAllStreamNames(ctx context.Context) ([]string, error) {
-	streams := []string{}
+		return c.RowsAffected(), err
+	})
+}
 
-	rows, err := ps.db.Query(ctx, fmt.Sprintf(`SELECT real_stream_name FROM %s WHERE real_stream_name NOT LIKE '$%%'`, EventStreamsTable))
+// StreamInfo returns the statistics of the EventStream
+func (ps PersistenceStrategy) StreamInfo(ctx context.Context, streamName string) (StreamInfo, error) {
+	infos, err := ps.StreamsInfo(ctx, streamName)
 	if err != nil {
-		return streams, err
+		return StreamInfo{}, err
 	}
 
-	for rows.Next() {
-		var stream string
+	return infos[0], nil
+}
 
-		err = rows.Scan(&stream)
-		if err != nil {
-			return []string{}, err
-		}
+// StreamsInfo returns the statistics of all given EventStreams in the given order with a single batch of queries
+func (ps PersistenceStrategy) StreamsInfo(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "no", ps.streamEvents, false)
+}
 
-		streams = append(streams, stream)
-	}
+// StreamsInfoWithAggregates returns the statistics of all given EventStreams like StreamsInfo including their number of distinct aggregates
+// Counting the aggregates reads the metadata of all Events of the EventStreams
+func (ps PersistenceStrategy) StreamsInfoWithAggregates(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "no", ps.streamEvents, true)
+}
 
-	return streams, nil
+func (ps PersistenceStrategy) streamEvents(streamName string, streamID int) (string, string, []interface{}) {
+	return ps.table(GenerateTableName(streamName)), "TRUE", nil
 }
 
-func (ps PersistenceStrategy) HasStream(ctx context.Context, streamName string) (bool, error) {
-	c, err := ps.db.Exec(ctx, fmt.Sprintf(`SELECT real_stream_name FROM %s WHERE real_stream_name = $1`, EventStreamsTable), streamName)
-	if err != nil {
-		return false, err
-	}
-	if c.RowsAffected() == 0 {
-		return false, nil
-	}
+// PurgeDeletedStreams deletes the EventStreams soft deleted longer than the grace period ago with all their Events
+func (ps PersistenceStrategy) PurgeDeletedStreams(ctx context.Context, gracePeriod time.Duration) ([]string, error) {
+	return ps.purgeDeletedStreams(ctx, gracePeriod, ps.dropSchema)
+}
 
-	return true, nil
+// CreateStreamWithMetadata creates a new EventStream like EventStore.CreateStream with initial metadata
+func (ps PersistenceStrategy) CreateStreamWithMetadata(ctx context.Context, streamName string, metadata map[string]interface{}) error {
+	return ps.createStream(ctx, streamName, metadata, ps.CreateSchema)
 }
 
-func (ps PersistenceStrategy) DeleteStream(ctx context.Context, streamName string) error {
-	err := ps.RemoveStreamFromStreamsTable(ctx, streamName)
+func (ps PersistenceStrategy) CreateSchema(ctx context.Context, streamName string) error {
+	return ps.createSchema(ctx, ps.db, streamName)
+}
+
+func (ps PersistenceStrategy) createSchema(ctx context.Context, db execer, streamName string) error {
+	tableName := ps.table(GenerateTableName(streamName))
+	_, err := db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s,
+			PRIMARY KEY (no),
+			UNIQUE (event_id),
+			UNIQUE (position)
+		);`, tableName, ps.streamTableColumns()))
 	if err != nil {
 		return err
 	}
 
-	return ps.DropSchema(ctx, streamName)
+	return createAggregateIndexes(ctx, db, tableName)
 }
 
-func (ps PersistenceStrategy) CreateSchema(ctx context.Context, streamName string) error {
-	tableName := GenerateTableName(streamName)
-	_, err := ps.db.Exec(ctx, fmt.Sprintf(`
-		CREATE TABLE %s (
-			no BIGSERIAL,
+// streamTableColumns are the columns and CHECK constraints shared by all EventStream Tables
+func (ps PersistenceStrategy) streamTableColumns() string {
+	return fmt.Sprintf(`no BIGSERIAL,
+			position BIGINT NOT NULL DEFAULT nextval('%s'),
 			event_id UUID NOT NULL,
 			event_name VARCHAR(100) NOT NULL,
-			payload JSON NOT NULL,
+			payload JSONB,
 			metadata JSONB NOT NULL,
 			created_at TIMESTAMP(6) NOT NULL,
-			PRIMARY KEY (no),
+			content_type VARCHAR(100) NOT NULL DEFAULT 'application/json',
+			payload_bytes BYTEA,
 			CONSTRAINT aggregate_version_not_null CHECK ((metadata->>'_aggregate_version') IS NOT NULL),
 			CONSTRAINT aggregate_type_not_null CHECK ((metadata->>'_aggregate_type') IS NOT NULL),
 			CONSTRAINT aggregate_id_not_null CHECK ((metadata->>'_aggregate_id') IS NOT NULL),
-			UNIQUE (event_id)
-		);`, tableName))
+			%s`, ps.table(PositionSequence), payloadContentTypeCheck)
+}
+
+func createAggregateIndexes(ctx context.Context, db execer, tableName string) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s ((metadata->>'_aggregate_type'), (metadata->>'_aggregate_id'), (metadata->>'_aggregate_version'));`, tableName))
 	if err != nil {
 		return err
 	}
 
-	_, err = ps.db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s ((metadata->>'_aggregate_type'), (metadata->>'_aggregate_id'), (metadata->>'_aggregate_version'));`, tableName))
+	_, err = db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s ((metadata->>'_aggregate_type'), (metadata->>'_aggregate_id'), no);`, tableName))
+
+	return err
+}
+
+func (ps PersistenceStrategy) DropSchema(ctx context.Context, streamName string) error {
+	return ps.dropSchema(ctx, ps.db, streamName)
+}
+
+func (ps PersistenceStrategy) dropSchema(ctx context.Context, db execer, streamName string) error {
+	tableName := ps.table(GenerateTableName(streamName))
+	_, err := db.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, tableName))
 	if err != nil {
 		return err
 	}
 
-	_, err = ps.db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s ((metadata->>'_aggregate_type'), (metadata->>'_aggregate_id'), no);`, tableName))
+	return nil
+}
+
+func (ps PersistenceStrategy) AppendTo(ctx context.Context, streamName string, events []eventstore.DomainEvent) error {
+	tx, err := ps.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	if ps.idempotent {
+		appended, err := alreadyAppended(ctx, tx, streamName, events, fmt.Sprintf(`SELECT event_id FROM %s WHERE event_id = ANY($1::UUID[]) ORDER BY no`, ps.table(GenerateTableName(streamName))))
+		if err != nil || appended {
+			return err
+		}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (ps PersistenceStrategy) DropSchema(ctx context.Context, streamName string) error {
-	tableName := GenerateTableName(streamName)
-	_, err := ps.db.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, tableName))
+// AppendToWithExpectedVersion appends the events of a single Aggregate if its persisted version equals the expectedVersion
+// All events have to belong to the same Aggregate, an expectedVersion of 0 means the Aggregate has no persisted events yet
+func (ps PersistenceStrategy) AppendToWithExpectedVersion(ctx context.Context, streamName string, expectedVersion int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tableName := ps.table(GenerateTableName(streamName))
+	aggregateType := events[0].AggregateType()
+	aggregateID := events[0].AggregateID()
+
+	tx, err := ps.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	actualVersion, err := ps.fetchAggregateVersion(ctx, tx, tableName, aggregateType, aggregateID)
+	if err != nil {
+		return err
+	}
+	if actualVersion != expectedVersion {
+		return ConcurrencyConflict{Stream: streamName, AggregateID: aggregateID, ExpectedVersion: expectedVersion, ActualVersion: actualVersion}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if isUniqueViolation(err) {
+		tx.Rollback(ctx)
+
+		actualVersion, err = ps.fetchAggregateVersion(ctx, ps.db, tableName, aggregateType, aggregateID)
+		if err != nil {
+			return err
+		}
+
+		return ConcurrencyConflict{Stream: streamName, AggregateID: aggregateID, ExpectedVersion: expectedVersion, ActualVersion: actualVersion}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (ps PersistenceStrategy) AppendTo(ctx context.Context, streamName string, events []eventstore.DomainEvent) error {
-	tableName := GenerateTableName(streamName)
+// AppendToWithExpectedHead appends the events if the highest event number of the EventStream equals the expectedHead
+// The EventStream is locked against concurrent writers until the events are committed
+func (ps PersistenceStrategy) AppendToWithExpectedHead(ctx context.Context, streamName string, expectedHead int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tableName := ps.table(GenerateTableName(streamName))
 
 	tx, err := ps.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, tableName))
+	if err != nil {
+		return err
+	}
+
+	var actualHead int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(no), 0) FROM %s`, tableName)).Scan(&actualHead)
+	if err != nil {
+		return err
+	}
+	if actualHead != expectedHead {
+		return ConcurrencyConflict{Stream: streamName, AggregateID: uuid.Nil, ExpectedVersion: expectedHead, ActualVersion: actualHead}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BulkAppend appends all Events of the source in one transaction using the COPY protocol and returns their number
+// It is meant for large imports into an EventStream and does not support WithIdempotentAppends
+func (ps PersistenceStrategy) BulkAppend(ctx context.Context, streamName string, source EventSource) (int64, error) {
+	tableName := ps.table(GenerateTableName(streamName))
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	partitioned, head, err := ps.partitionedHead(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := ps.copyEvents(ctx, tx, GenerateTableName(streamName), []string{"event_id", "event_name", "payload", "payload_bytes", "content_type", "metadata", "created_at"}, source, func(ev eventstore.DomainEvent) ([]interface{}, error) {
+		payload, err := ps.serializePayload(ev)
+
+		return []interface{}{ev.UUID().String(), ev.Name(), payload.payload, payload.bytes, payload.contentType, ps.eventMetadata(ev), ev.CreatedAt()}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if partitioned {
+		err = ps.assertUniqueAcrossPartitions(ctx, tx, streamName, head)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	batch := &pgx.Batch{}
+
+	if ps.outbox {
+		ps.queueOutboxCopy(batch, streamName, fmt.Sprintf(`FROM %s WHERE no > $2 ORDER BY no`, tableName), head)
+	}
+	if ps.notify && count > 0 {
+		ps.queueNotification(batch, streamName, fmt.Sprintf(`SELECT MAX(no) FROM %s`, tableName))
+	}
+
+	err = sendBatch(ctx, tx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+func (ps PersistenceStrategy) insertEvents(ctx context.Context, tx pgx.Tx, streamName string, events []eventstore.DomainEvent) error {
+	tableName := ps.table(GenerateTableName(streamName))
 	batch := &pgx.Batch{}
 
+	partitioned, head, err := ps.partitionedHead(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
 	for _, ev := range events {
+		payload, err := ps.serializePayload(ev)
+		if err != nil {
+			return err
+		}
+
 		batch.Queue(
-			fmt.Sprintf(`INSERT INTO %s (event_id, event_name, payload, metadata, created_at) VALUES ($1, $2, $3, $4, $5)`, tableName),
+			fmt.Sprintf(`INSERT INTO %s (event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`, tableName),
 			ev.UUID().String(),
 			ev.Name(),
-			ev.Payload(),
-			ev.Metadata(),
+			payload.payload,
+			payload.bytes,
+			payload.contentType,
+			ps.eventMetadata(ev),
 			ev.CreatedAt(),
 		)
+
+		if ps.outbox {
+			ps.queueOutboxMessage(batch, streamName, ev, payload)
+		}
 	}
 
-	br := tx.SendBatch(ctx, batch)
-	err = br.Close()
-	if err != nil {
+	if ps.notify {
+		ps.queueNotification(batch, streamName, fmt.Sprintf(`SELECT MAX(no) FROM %s`, tableName))
+	}
+
+	err = tx.SendBatch(ctx, batch).Close()
+	if err != nil || !partitioned {
 		return err
 	}
 
-	err = tx.Commit(ctx)
+	return ps.assertUniqueAcrossPartitions(ctx, tx, streamName, head)
+}
+
+func (ps PersistenceStrategy) fetchAggregateVersion(ctx context.Context, q queryer, tableName, aggregateType string, aggregateID uuid.UUID) (int, error) {
+	var version int
+
+	err := q.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT COALESCE(MAX(CAST(metadata->>'_aggregate_version' AS INT)), 0) FROM %s WHERE metadata->>'_aggregate_type' = $1 AND metadata->>'_aggregate_id' = $2`, tableName),
+		aggregateType,
+		aggregateID.String(),
+	).Scan(&version)
+
+	return version, err
+}
+
+// TruncateStreamBefore removes all Events with a lower number and returns the number of removed Events
+// With archive the Events are moved into the Table named by GenerateArchiveTableName instead
+func (ps PersistenceStrategy) TruncateStreamBefore(ctx context.Context, streamName string, number int, archive bool) (int64, error) {
+	return ps.truncateStream(ctx, streamName, number, archive, GenerateTableName(streamName), `no < $1`)
+}
+
+// TruncateStreamBeforeTime removes all Events before the first Event created at or after the given time
+func (ps PersistenceStrategy) TruncateStreamBeforeTime(ctx context.Context, streamName string, createdAt time.Time, archive bool) (int64, error) {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+
+	tableName := ps.table(GenerateTableName(streamName))
+	err = ps.db.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MIN(no), (SELECT COALESCE(MAX(no), 0) + 1 FROM %[1]s)) FROM %[1]s WHERE created_at >= $1`, tableName), createdAt).Scan(&number)
 	if err != nil {
-		tx.Rollback(ctx)
-		return err
+		return 0, err
 	}
 
-	return nil
+	return ps.TruncateStreamBefore(ctx, streamName, number, archive)
 }
 
+// Load returns StreamTruncated if fromNumber is before the truncation point of the EventStream, 0 loads from the oldest available Event
 func (ps PersistenceStrategy) Load(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
-	query, values, err := ps.createQuery(ctx, streamName, fromNumber, 0, matcher)
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, fromNumber, 0, 0, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.newIterator(ctx, query, values, count), nil
+}
+
+// LoadReverse loads Events of the given EventStream newest first, beginning with fromNumber or with the latest Event if fromNumber is 0
+func (ps PersistenceStrategy) LoadReverse(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, 0, 0, 0, matcher)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDomainEventIterator(ctx, ps.db, query, values, count), nil
+	return ps.newReverseIterator(ctx, query, values, fromNumber, count), nil
 }
 
 func (ps PersistenceStrategy) MergeAndLoad(ctx context.Context, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, 0, count, streams...)
+}
+
+// MergeAndLoadFromPosition loads Events of multiple EventStreams in the order of their global position, beginning with fromPosition
+func (ps PersistenceStrategy) MergeAndLoadFromPosition(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, fromPosition, count, streams...)
+}
+
+func (ps PersistenceStrategy) mergeAndLoad(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (*DomainEventIterator, error) {
 	var paramCounter int
 	var queries []string
 	var parameters []interface{}
 
 	for _, stream := range streams {
-		query, values, err := ps.createQuery(ctx, stream.StreamName, stream.FromNumber, paramCounter, stream.Matcher)
+		query, values, err := ps.createQuery(ctx, stream.StreamName, stream.FromNumber, fromPosition, paramCounter, stream.Matcher)
 		if err != nil {
 			return nil, err
 		}
@@ -248,39 +537,46 @@ func (ps PersistenceStrategy) MergeAndLoad(ctx context.Context, count int, strea
 		parameters = append(parameters, values...)
 	}
 
-	groupedQuery := queries[0]
+	groupedQuery := strings.Join(queries, " UNION ALL ")
+	it := ps.newIterator(ctx, groupedQuery, parameters, count)
 
-	if len(queries) > 1 {
-		groupedQuery = strings.Join(queries, " UNION ALL ") + " ORDER BY created_at ASC"
+	if len(queries) > 1 || fromPosition > 0 {
+		it.orderBy = mergedStreamsOrder
 	}
 
-	return NewDomainEventIterator(ctx, ps.db, groupedQuery, parameters, count), nil
+	return it, nil
 }
 
-func (ps PersistenceStrategy) createQuery(ctx context.Context, streamName string, fromNumber, paramCounter int, matcher eventstore.MetadataMatcher) (string, []interface{}, error) {
-	c, err := ps.db.Exec(ctx, fmt.Sprintf(`SELECT stream_name FROM %s WHERE real_stream_name = $1`, EventStreamsTable), streamName)
+func (ps PersistenceStrategy) createQuery(ctx context.Context, streamName string, fromNumber, fromPosition, paramCounter int, matcher eventstore.MetadataMatcher) (string, []interface{}, error) {
+	err := ps.assertStreamExists(ctx, streamName)
 	if err != nil {
 		return "", []interface{}{}, err
 	}
-	if c.RowsAffected() == 0 {
-		return "", []interface{}{}, eventstore.StreamNotFound{Stream: streamName}
-	}
 
-	tableName := GenerateTableName(streamName)
+	tableName := ps.table(GenerateTableName(streamName))
 
-	wheres, values, err := ps.createWhereClause(paramCounter, matcher)
+	wheres, values, err := createWhereClause(paramCounter, matcher, messageProperties)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
 
 	wheres = append(wheres, fmt.Sprintf(`no >= $%d`, paramCounter+len(values)+1))
 	values = append(values, fromNumber)
 
+	if fromPosition > 0 {
+		wheres = append(wheres, fmt.Sprintf(`position >= $%d`, paramCounter+len(values)+1))
+		values = append(values, fromPosition)
+	}
+
 	whereCondition := fmt.Sprintf(`WHERE %s`, strings.Join(wheres, " AND "))
 
-	query := fmt.Sprintf(`SELECT no, event_id, event_name, payload, metadata, created_at, '%s' as stream FROM %s %s ORDER BY no ASC`, streamName, tableName, whereCondition)
+	query := fmt.Sprintf(`SELECT no, event_id, event_name, payload, metadata, created_at, $%d::TEXT AS stream, position, content_type, payload_bytes FROM %s %s`, paramCounter+len(values)+1, tableName, whereCondition)
+	values = append(values, streamName)
 
 	return query, values, nil
 }
 
-func (ps PersistenceStrategy) createWhereClause(paramCounter int, matcher eventstore.MetadataMatcher) ([]string, []interface{}, error) {
+func createWhereClause(paramCounter int, matcher eventstore.MetadataMatcher, properties map[string]messageProperty) ([]string, []interface{}, error) {
 	var wheres []string
 	var values []interface{}
 
@@ -296,11 +592,11 @@ func (ps PersistenceStrategy) createWhereClause(paramCounter int, matcher events
 		switch match.Operation {
 		case eventstore.InOperator:
 			expression = func(value string) string {
-				return fmt.Sprintf("ANY(%s::text[])", value)
+				return fmt.Sprintf("= ANY(%s::text[])", value)
 			}
 		case eventstore.NotInOperator:
 			expression = func(value string) string {
-				return fmt.Sprintf("NOT IN ANY(%s::text[])", value)
+				return fmt.Sprintf("<> ALL(%s::text[])", value)
 			}
 		case eventstore.RegexOperator:
 			expression = func(value string) string {
@@ -329,24 +625,42 @@ func (ps PersistenceStrategy) createWhereClause(paramCounter int, matcher events
 			}
 		}
 
+		if match.FieldType == PayloadField {
+			paramCounter++
+
+			where, value, err := payloadWhereClause(match, "$"+strconv.Itoa(paramCounter))
+			if err != nil {
+				return wheres, values, err
+			}
+
+			wheres = append(wheres, where)
+			values = append(values, value)
+		}
+
 		if match.FieldType == eventstore.MessagePropertyField {
-			switch v := match.Value.(type) {
-			case bool:
-				wheres = append(wheres, fmt.Sprintf(`%s %s`, match.Field, expression(strconv.FormatBool(v))))
-			default:
-				paramCounter++
-				values = append(values, match.Value)
+			paramCounter++
 
-				wheres = append(wheres, `%s %s`, match.Field, expression(("$" + strconv.Itoa(paramCounter))))
+			where, value, err := messagePropertyWhereClause(properties, match, "$"+strconv.Itoa(paramCounter))
+			if err != nil {
+				return wheres, values, err
 			}
+
+			wheres = append(wheres, where)
+			values = append(values, value)
 		}
 	}
 
 	return wheres, values, nil
 }
 
-func NewPersistenceStrategy(db *pgxpool.Pool) *PersistenceStrategy {
+func isUniqueViolation(err error) bool {
+	e, ok := err.(*pgconn.PgError)
+
+	return ok && (e.Code == "23505" || e.Code == "23000")
+}
+
+func NewPersistenceStrategy(db *pgxpool.Pool, options ...Option) *PersistenceStrategy {
 	return &PersistenceStrategy{
-		db: db,
+		streamRegistry: streamRegistry{config: newConfig(options), db: db, migrations: tablePerStreamMigrations, strategy: tablePerStreamStrategy},
 	}
 }
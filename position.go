@@ -0,0 +1,48 @@
+package pg
+
+import (
+	"context"
+
+	eventstore "github.com/go-event-store/eventstore"
+)
+
+const PositionSequence = "event_position_seq"
+
+// StreamKey is the metadata key of the EventStream a loaded Event was read from
+// It is set by the DomainEventIterator and never persisted, a metadata value of an appended Event with this key is dropped
+const StreamKey = "stream"
+
+// positionKey is the metadata key of the global position of a loaded Event, read it with GlobalPosition
+const positionKey = "_position"
+
+// PositionKey is the key of the global position in the stream positions of a projection
+const PositionKey = "$position"
+
+// GlobalPosition returns the store wide position of a loaded Event
+// Positions are only increasing in commit order over all EventStreams of a PersistenceStrategy created WithOrderedPositions,
+// otherwise concurrent appends to different EventStreams can commit a lower position after a higher one
+func GlobalPosition(event eventstore.DomainEvent) int {
+	switch v := event.Metadata()[positionKey].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// lockAppends serializes the appending transactions of the EventStream until commit
+// WithOrderedPositions serializes all appending transactions of the store instead,
+// so Events with a lower global position can never become visible after Events with a higher one
+func (c config) lockAppends(ctx context.Context, tx execer, streamName string) error {
+	key := c.table(GenerateTableName(streamName))
+
+	if c.orderedPositions {
+		key = c.table(PositionSequence)
+	}
+
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key)
+
+	return err
+}
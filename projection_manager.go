@@ -10,13 +10,14 @@ import (
 )
 
 type ProjectionManager struct {
+	config
 	db *pgxpool.Pool
 }
 
 func (pm ProjectionManager) FetchProjectionStatus(ctx context.Context, projectionName string) (eventstore.Status, error) {
 	var status eventstore.Status
 
-	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT status FROM %s WHERE name = $1;`, ProjectionsTable), projectionName)
+	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT status FROM %s WHERE name = $1;`, pm.table(ProjectionsTable)), projectionName)
 	err := row.Scan(&status)
 
 	return status, err
@@ -25,7 +26,7 @@ func (pm ProjectionManager) FetchProjectionStatus(ctx context.Context, projectio
 func (pm ProjectionManager) CreateProjection(ctx context.Context, projectionName string, state interface{}, status eventstore.Status) error {
 	_, err := pm.db.Exec(
 		ctx,
-		fmt.Sprintf(`INSERT INTO %s (name, position, state, status, locked_until) VALUES ($1, $2, $3, $4, NULL)`, ProjectionsTable),
+		fmt.Sprintf(`INSERT INTO %s (name, position, state, status, locked_until) VALUES ($1, $2, $3, $4, NULL)`, pm.table(ProjectionsTable)),
 		projectionName,
 		map[string]int{},
 		state,
@@ -36,7 +37,7 @@ func (pm ProjectionManager) CreateProjection(ctx context.Context, projectionName
 }
 
 func (pm ProjectionManager) DeleteProjection(ctx context.Context, projectionName string) error {
-	c, err := pm.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE "name" = $1`, ProjectionsTable), projectionName)
+	c, err := pm.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE "name" = $1`, pm.table(ProjectionsTable)), projectionName)
 	if c.RowsAffected() == 0 {
 		return eventstore.ProjectionNotFound{Name: projectionName}
 	}
@@ -47,7 +48,7 @@ func (pm ProjectionManager) DeleteProjection(ctx context.Context, projectionName
 func (pm ProjectionManager) ResetProjection(ctx context.Context, projectionName string, state interface{}) error {
 	c, err := pm.db.Exec(
 		ctx,
-		fmt.Sprintf(`UPDATE %s SET status = $1, state = $2, position = $3 WHERE "name" = $4`, ProjectionsTable),
+		fmt.Sprintf(`UPDATE %s SET status = $1, state = $2, position = $3 WHERE "name" = $4`, pm.table(ProjectionsTable)),
 		eventstore.StatusIdle,
 		state,
 		map[string]int{},
@@ -64,7 +65,7 @@ func (pm ProjectionManager) ResetProjection(ctx context.Context, projectionName
 func (pm ProjectionManager) PersistProjection(ctx context.Context, projectionName string, state interface{}, streamPositions map[string]int) error {
 	c, err := pm.db.Exec(
 		ctx,
-		fmt.Sprintf(`UPDATE %s SET status = $1, state = $2, position = $3 WHERE "name" = $4`, ProjectionsTable),
+		fmt.Sprintf(`UPDATE %s SET status = $1, state = $2, position = $3 WHERE "name" = $4`, pm.table(ProjectionsTable)),
 		eventstore.StatusIdle,
 		state,
 		streamPositions,
@@ -78,10 +79,16 @@ func (pm ProjectionManager) PersistProjection(ctx context.Context, projectionNam
 	return err
 }
 
+// PersistProjectionPosition persists the current state and the global position of the given projection
+// It replaces the stream positions, so a projection should either checkpoint per EventStream or on the global position
+func (pm ProjectionManager) PersistProjectionPosition(ctx context.Context, projectionName string, state interface{}, position int) error {
+	return pm.PersistProjection(ctx, projectionName, state, map[string]int{PositionKey: position})
+}
+
 func (pm ProjectionManager) UpdateProjectionStatus(ctx context.Context, projectionName string, status eventstore.Status) error {
 	c, err := pm.db.Exec(
 		ctx,
-		fmt.Sprintf(`UPDATE %s SET status = $1 WHERE "name" = $2`, ProjectionsTable),
+		fmt.Sprintf(`UPDATE %s SET status = $1 WHERE "name" = $2`, pm.table(ProjectionsTable)),
 		status,
 		projectionName,
 	)
@@ -97,7 +104,7 @@ func (pm ProjectionManager) LoadProjection(ctx context.Context, projectionName s
 	position := map[string]int{}
 	var state interface{}
 
-	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT position, state FROM %s WHERE name = $1 LIMIT 1`, ProjectionsTable), projectionName)
+	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT position, state FROM %s WHERE name = $1 LIMIT 1`, pm.table(ProjectionsTable)), projectionName)
 	err := row.Scan(&position, &state)
 	if err == pgx.ErrNoRows {
 		return position, state, eventstore.ProjectionNotFound{Name: projectionName}
@@ -106,10 +113,17 @@ func (pm ProjectionManager) LoadProjection(ctx context.Context, projectionName s
 	return position, state, err
 }
 
+// LoadProjectionPosition loads latest state and global position of the given projection
+func (pm ProjectionManager) LoadProjectionPosition(ctx context.Context, projectionName string) (int, interface{}, error) {
+	positions, state, err := pm.LoadProjection(ctx, projectionName)
+
+	return positions[PositionKey], state, err
+}
+
 func (pm ProjectionManager) ProjectionExists(ctx context.Context, projectionName string) (bool, error) {
 	var name string
 
-	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT name FROM %s WHERE name = $1;`, ProjectionsTable), projectionName)
+	row := pm.db.QueryRow(ctx, fmt.Sprintf(`SELECT name FROM %s WHERE name = $1;`, pm.table(ProjectionsTable)), projectionName)
 	err := row.Scan(&name)
 	if err == pgx.ErrNoRows {
 		return false, nil
@@ -121,6 +135,6 @@ func (pm ProjectionManager) ProjectionExists(ctx context.Context, projectionName
 	return true, err
 }
 
-func NewProjectionManager(db *pgxpool.Pool) *ProjectionManager {
-	return &ProjectionManager{db: db}
+func NewProjectionManager(db *pgxpool.Pool, options ...Option) *ProjectionManager {
+	return &ProjectionManager{config: newConfig(options), db: db}
 }
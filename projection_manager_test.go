@@ -74,6 +74,31 @@ func Test_PostgresProjectionManager(t *testing.T) {
 		}
 	})
 
+	t.Run("Persist global Projection Position", func(t *testing.T) {
+		err := pm.CreateProjection(ctx, "position", map[string]interface{}{"state": 0}, eventstore.StatusIdle)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = pm.PersistProjectionPosition(ctx, "position", map[string]interface{}{"state": 1}, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		position, _, err := pm.LoadProjectionPosition(ctx, "position")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != 42 {
+			t.Errorf("Expected position 42, got %d", position)
+		}
+
+		err = pm.DeleteProjection(ctx, "position")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
 	t.Run("Fetch ProjectionState", func(t *testing.T) {
 		err := pm.CreateProjection(ctx, "status", map[string]interface{}{"state": 0}, eventstore.StatusIdle)
 		if err != nil {
@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	eventstore "github.com/go-event-store/eventstore"
+)
+
+// JSONContentType is the content type of payloads stored in the JSONB payload column
+// Only these payloads can be filtered with a PayloadField matcher
+const JSONContentType = "application/json"
+
+// payloadContentTypeCheck is the CHECK constraint of all Tables with Events, JSON payloads are stored in payload and all others in payload_bytes
+const payloadContentTypeCheck = `CONSTRAINT payload_content_type CHECK ((content_type = 'application/json') = (payload IS NOT NULL AND payload_bytes IS NULL))`
+
+// Serializer encodes the payloads of appended Events and decodes the payloads of loaded Events
+// The content type is stored with each Event, payloads of any other content type than JSONContentType are stored in the payload_bytes column
+type Serializer interface {
+	ContentType() string
+	Marshal(payload interface{}) ([]byte, error)
+	Unmarshal(data []byte, payload interface{}) error
+}
+
+// JSONSerializer is the default Serializer of all PersistenceStrategies
+type JSONSerializer struct{}
+
+func (JSONSerializer) ContentType() string {
+	return JSONContentType
+}
+
+func (JSONSerializer) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (JSONSerializer) Unmarshal(data []byte, payload interface{}) error {
+	return json.Unmarshal(data, payload)
+}
+
+// serializedPayload holds the values of the payload, payload_bytes and content_type columns of an Event
+type serializedPayload struct {
+	payload     interface{}
+	bytes       []byte
+	contentType string
+}
+
+// serializePayload encodes the payload of an appended Event with the first configured Serializer
+// Without Serializers the payload is passed to pgx, which encodes it as JSON
+func (c config) serializePayload(event eventstore.DomainEvent) (serializedPayload, error) {
+	if len(c.serializers) == 0 {
+		return serializedPayload{payload: event.Payload(), contentType: JSONContentType}, nil
+	}
+
+	serializer := c.serializers[0]
+
+	data, err := serializer.Marshal(event.Payload())
+	if err != nil {
+		return serializedPayload{}, err
+	}
+
+	if serializer.ContentType() == JSONContentType {
+		return serializedPayload{payload: data, contentType: JSONContentType}, nil
+	}
+
+	return serializedPayload{bytes: data, contentType: serializer.ContentType()}, nil
+}
+
+// findSerializer returns the Serializer decoding payloads of the content type, JSON payloads are decoded by the JSONSerializer by default
+func findSerializer(serializers []Serializer, contentType string) (Serializer, error) {
+	for _, serializer := range serializers {
+		if serializer.ContentType() == contentType {
+			return serializer, nil
+		}
+	}
+
+	if contentType == JSONContentType {
+		return JSONSerializer{}, nil
+	}
+
+	return nil, fmt.Errorf("No Serializer configured for content type %s", contentType)
+}
@@ -0,0 +1,548 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+
+	eventstore "github.com/go-event-store/eventstore"
+	uuid "github.com/satori/go.uuid"
+)
+
+const EventsTable = "events"
+
+// SingleTablePersistenceStrategy persists the Events of all EventStreams in one shared Table
+// Events are assigned to their EventStream by the stream_name column and numbered per EventStream by the version column,
+// the no column of the shared Table is their global position
+type SingleTablePersistenceStrategy struct {
+	streamRegistry
+}
+
+func (ps SingleTablePersistenceStrategy) CreateEventStreamsTable(ctx context.Context) error {
+	err := ps.streamRegistry.CreateEventStreamsTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	exists, err := ps.tableExists(ctx, ps.db, EventsTable)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+	_, err = ps.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			no BIGSERIAL,
+			stream_name VARCHAR(150) NOT NULL,
+			version BIGINT NOT NULL,
+			event_id UUID NOT NULL,
+			event_name VARCHAR(100) NOT NULL,
+			payload JSONB,
+			metadata JSONB NOT NULL,
+			created_at TIMESTAMP(6) NOT NULL,
+			content_type VARCHAR(100) NOT NULL DEFAULT 'application/json',
+			payload_bytes BYTEA,
+			PRIMARY KEY (no),
+			CONSTRAINT aggregate_version_not_null CHECK ((metadata->>'_aggregate_version') IS NOT NULL),
+			CONSTRAINT aggregate_type_not_null CHECK ((metadata->>'_aggregate_type') IS NOT NULL),
+			CONSTRAINT aggregate_id_not_null CHECK ((metadata->>'_aggregate_id') IS NOT NULL),
+			UNIQUE (event_id),
+			%s
+		);`, ps.table(EventsTable), payloadContentTypeCheck))
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(ctx, fmt.Sprintf(`CREATE UNIQUE INDEX ON %s (stream_name, (metadata->>'_aggregate_type'), (metadata->>'_aggregate_id'), (metadata->>'_aggregate_version'));`, ps.table(EventsTable)))
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(ctx, fmt.Sprintf(`CREATE INDEX ON %s (stream_name, no);`, ps.table(EventsTable)))
+	if err != nil {
+		return err
+	}
+
+	return ps.createEventNumberIndex(ctx, ps.db)
+}
+
+func (c config) createEventNumberIndex(ctx context.Context, db execer) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(
+		`CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (stream_name, version);`,
+		pgx.Identifier{c.prefix + EventsTable + "_stream_name_version_idx"}.Sanitize(),
+		c.table(EventsTable),
+	))
+
+	return err
+}
+
+func (ps SingleTablePersistenceStrategy) DeleteStream(ctx context.Context, streamName string) error {
+	err := ps.RemoveStreamFromStreamsTable(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	return ps.DropSchema(ctx, streamName)
+}
+
+// RenameStream renames the EventStream and moves its Events in one transaction
+func (ps SingleTablePersistenceStrategy) RenameStream(ctx context.Context, from, to string) error {
+	return ps.renameStream(ctx, from, to, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET stream_name = $1 WHERE stream_name = $2`, ps.table(EventsTable)), to, from)
+
+		return err
+	})
+}
+
+// CopyStream creates the EventStream to with the metadata of from and a copy of the Events of from matching the matcher
+// Copied Events keep their order but get a new event_id and consecutive numbers, it returns the number of copied Events
+func (ps SingleTablePersistenceStrategy) CopyStream(ctx context.Context, from, to string, matcher eventstore.MetadataMatcher) (int64, error) {
+	query, values, err := ps.createQuery(ctx, from, 0, 0, 1, matcher)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.copyStream(ctx, from, to, nil, func(ctx context.Context, tx pgx.Tx) (int64, error) {
+		c, err := tx.Exec(
+			ctx,
+			fmt.Sprintf(
+				`INSERT INTO %s (stream_name, version, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) SELECT $1, ROW_NUMBER() OVER (ORDER BY no), %s, event_name, payload, payload_bytes, content_type, metadata, created_at FROM (%s) AS events ORDER BY no`,
+				ps.table(EventsTable),
+				copiedEventID("event_id", "$1"),
+				query,
+			),
+			append([]interface{}{to}, values...)...,
+		)
+
+		return c.RowsAffected(), err
+	})
+}
+
+// StreamInfo returns the statistics of the EventStream
+func (ps SingleTablePersistenceStrategy) StreamInfo(ctx context.Context, streamName string) (StreamInfo, error) {
+	infos, err := ps.StreamsInfo(ctx, streamName)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+
+	return infos[0], nil
+}
+
+// StreamsInfo returns the statistics of all given EventStreams in the given order with a single batch of queries
+func (ps SingleTablePersistenceStrategy) StreamsInfo(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "version", ps.streamEvents, false)
+}
+
+// StreamsInfoWithAggregates returns the statistics of all given EventStreams like StreamsInfo including their number of distinct aggregates
+// Counting the aggregates reads the metadata of all Events of the EventStreams
+func (ps SingleTablePersistenceStrategy) StreamsInfoWithAggregates(ctx context.Context, streamNames ...string) ([]StreamInfo, error) {
+	return ps.streamsInfo(ctx, streamNames, "version", ps.streamEvents, true)
+}
+
+func (ps SingleTablePersistenceStrategy) streamEvents(streamName string, streamID int) (string, string, []interface{}) {
+	return ps.table(EventsTable), "stream_name = $1", []interface{}{streamName}
+}
+
+// PurgeDeletedStreams deletes the EventStreams soft deleted longer than the grace period ago with all their Events
+func (ps SingleTablePersistenceStrategy) PurgeDeletedStreams(ctx context.Context, gracePeriod time.Duration) ([]string, error) {
+	return ps.purgeDeletedStreams(ctx, gracePeriod, ps.dropSchema)
+}
+
+// CreateStreamWithMetadata creates a new EventStream like EventStore.CreateStream with initial metadata
+func (ps SingleTablePersistenceStrategy) CreateStreamWithMetadata(ctx context.Context, streamName string, metadata map[string]interface{}) error {
+	return ps.createStream(ctx, streamName, metadata, ps.CreateSchema)
+}
+
+func (ps SingleTablePersistenceStrategy) CreateSchema(ctx context.Context, streamName string) error {
+	return nil
+}
+
+func (ps SingleTablePersistenceStrategy) DropSchema(ctx context.Context, streamName string) error {
+	return ps.dropSchema(ctx, ps.db, streamName)
+}
+
+func (ps SingleTablePersistenceStrategy) dropSchema(ctx context.Context, db execer, streamName string) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE stream_name = $1;`, ps.table(EventsTable)), streamName)
+
+	return err
+}
+
+func (ps SingleTablePersistenceStrategy) AppendTo(ctx context.Context, streamName string, events []eventstore.DomainEvent) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	if ps.idempotent {
+		appended, err := alreadyAppended(ctx, tx, streamName, events, fmt.Sprintf(`SELECT event_id FROM %s WHERE event_id = ANY($1::UUID[]) AND stream_name = $2 ORDER BY no`, ps.table(EventsTable)), streamName)
+		if err != nil || appended {
+			return err
+		}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AppendToWithExpectedVersion appends the events of a single Aggregate if its persisted version equals the expectedVersion
+// All events have to belong to the same Aggregate, an expectedVersion of 0 means the Aggregate has no persisted events yet
+func (ps SingleTablePersistenceStrategy) AppendToWithExpectedVersion(ctx context.Context, streamName string, expectedVersion int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	aggregateType := events[0].AggregateType()
+	aggregateID := events[0].AggregateID()
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	actualVersion, err := ps.fetchAggregateVersion(ctx, tx, streamName, aggregateType, aggregateID)
+	if err != nil {
+		return err
+	}
+	if actualVersion != expectedVersion {
+		return ConcurrencyConflict{Stream: streamName, AggregateID: aggregateID, ExpectedVersion: expectedVersion, ActualVersion: actualVersion}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if isUniqueViolation(err) {
+		tx.Rollback(ctx)
+
+		actualVersion, err = ps.fetchAggregateVersion(ctx, ps.db, streamName, aggregateType, aggregateID)
+		if err != nil {
+			return err
+		}
+
+		return ConcurrencyConflict{Stream: streamName, AggregateID: aggregateID, ExpectedVersion: expectedVersion, ActualVersion: actualVersion}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AppendToWithExpectedHead appends the events if the highest event number of the EventStream equals the expectedHead
+// Like all appends it is serialized by the append lock of the EventStream, so the head can not change until the events are committed
+func (ps SingleTablePersistenceStrategy) AppendToWithExpectedHead(ctx context.Context, streamName string, expectedHead int, events []eventstore.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	actualHead, err := ps.fetchHead(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+	if actualHead != expectedHead {
+		return ConcurrencyConflict{Stream: streamName, AggregateID: uuid.Nil, ExpectedVersion: expectedHead, ActualVersion: actualHead}
+	}
+
+	err = ps.insertEvents(ctx, tx, streamName, events)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BulkAppend appends all Events of the source in one transaction using the COPY protocol and returns their number
+// It is meant for large imports into an EventStream and does not support WithIdempotentAppends
+func (ps SingleTablePersistenceStrategy) BulkAppend(ctx context.Context, streamName string, source EventSource) (int64, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = ps.lockAppends(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	err = ps.assertStreamWritable(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	head, err := ps.fetchHead(ctx, tx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	version := head
+
+	count, err := ps.copyEvents(ctx, tx, EventsTable, []string{"stream_name", "version", "event_id", "event_name", "payload", "payload_bytes", "content_type", "metadata", "created_at"}, source, func(ev eventstore.DomainEvent) ([]interface{}, error) {
+		version++
+
+		payload, err := ps.serializePayload(ev)
+
+		return []interface{}{streamName, version, ev.UUID().String(), ev.Name(), payload.payload, payload.bytes, payload.contentType, ps.eventMetadata(ev), ev.CreatedAt()}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := &pgx.Batch{}
+
+	if ps.outbox {
+		ps.queueOutboxCopy(batch, streamName, fmt.Sprintf(`FROM %s WHERE stream_name = $1 AND version > $2 ORDER BY version`, ps.table(EventsTable)), head)
+	}
+	if ps.notify && count > 0 {
+		ps.queueNotification(batch, streamName, `SELECT $3::BIGINT`, version)
+	}
+
+	err = sendBatch(ctx, tx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+// insertEvents numbers the events after the head of the EventStream, the caller has to hold the append lock of the EventStream
+func (ps SingleTablePersistenceStrategy) insertEvents(ctx context.Context, tx pgx.Tx, streamName string, events []eventstore.DomainEvent) error {
+	version, err := ps.fetchHead(ctx, tx, streamName)
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+
+	for _, ev := range events {
+		version++
+
+		payload, err := ps.serializePayload(ev)
+		if err != nil {
+			return err
+		}
+
+		batch.Queue(
+			fmt.Sprintf(`INSERT INTO %s (stream_name, version, event_id, event_name, payload, payload_bytes, content_type, metadata, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, ps.table(EventsTable)),
+			streamName,
+			version,
+			ev.UUID().String(),
+			ev.Name(),
+			payload.payload,
+			payload.bytes,
+			payload.contentType,
+			ps.eventMetadata(ev),
+			ev.CreatedAt(),
+		)
+
+		if ps.outbox {
+			ps.queueOutboxMessage(batch, streamName, ev, payload)
+		}
+	}
+
+	if ps.notify {
+		ps.queueNotification(batch, streamName, `SELECT $3::BIGINT`, version)
+	}
+
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// fetchHead returns the highest number of the EventStream, or the number before its truncation point if all its Events were truncated
+func (ps SingleTablePersistenceStrategy) fetchHead(ctx context.Context, q queryer, streamName string) (int, error) {
+	var head int
+
+	err := q.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT COALESCE(MAX(version), (SELECT GREATEST(truncated_before - 1, 0) FROM %s WHERE real_stream_name = $1), 0) FROM %s WHERE stream_name = $1`, ps.table(EventStreamsTable), ps.table(EventsTable)),
+		streamName,
+	).Scan(&head)
+
+	return head, err
+}
+
+func (ps SingleTablePersistenceStrategy) fetchAggregateVersion(ctx context.Context, q queryer, streamName, aggregateType string, aggregateID uuid.UUID) (int, error) {
+	var version int
+
+	err := q.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT COALESCE(MAX(CAST(metadata->>'_aggregate_version' AS INT)), 0) FROM %s WHERE stream_name = $1 AND metadata->>'_aggregate_type' = $2 AND metadata->>'_aggregate_id' = $3`, ps.table(EventsTable)),
+		streamName,
+		aggregateType,
+		aggregateID.String(),
+	).Scan(&version)
+
+	return version, err
+}
+
+// TruncateStreamBefore removes all Events with a lower number and returns the number of removed Events
+// With archive the Events are moved into the Table named by GenerateArchiveTableName instead
+func (ps SingleTablePersistenceStrategy) TruncateStreamBefore(ctx context.Context, streamName string, number int, archive bool) (int64, error) {
+	return ps.truncateStream(ctx, streamName, number, archive, EventsTable, `stream_name = $2 AND version < $1`, streamName)
+}
+
+// TruncateStreamBeforeTime removes all Events before the first Event created at or after the given time
+func (ps SingleTablePersistenceStrategy) TruncateStreamBeforeTime(ctx context.Context, streamName string, createdAt time.Time, archive bool) (int64, error) {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return 0, err
+	}
+
+	var number int
+
+	err = ps.db.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT COALESCE(MIN(version), (SELECT COALESCE(MAX(version), 0) + 1 FROM %[1]s WHERE stream_name = $1)) FROM %[1]s WHERE stream_name = $1 AND created_at >= $2`, ps.table(EventsTable)),
+		streamName,
+		createdAt,
+	).Scan(&number)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.TruncateStreamBefore(ctx, streamName, number, archive)
+}
+
+// Load returns StreamTruncated if fromNumber is before the truncation point of the EventStream, 0 loads from the oldest available Event
+func (ps SingleTablePersistenceStrategy) Load(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, fromNumber, 0, 0, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.newIterator(ctx, query, values, count), nil
+}
+
+// LoadReverse loads Events of the given EventStream newest first, beginning with fromNumber or with the latest Event if fromNumber is 0
+func (ps SingleTablePersistenceStrategy) LoadReverse(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error) {
+	err := ps.assertNotTruncated(ctx, streamName, fromNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	query, values, err := ps.createQuery(ctx, streamName, 0, 0, 0, matcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.newReverseIterator(ctx, query, values, fromNumber, count), nil
+}
+
+func (ps SingleTablePersistenceStrategy) MergeAndLoad(ctx context.Context, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, 0, count, streams...)
+}
+
+// MergeAndLoadFromPosition loads Events of multiple EventStreams in the order of their global position, beginning with fromPosition
+func (ps SingleTablePersistenceStrategy) MergeAndLoadFromPosition(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (eventstore.DomainEventIterator, error) {
+	return ps.mergeAndLoad(ctx, fromPosition, count, streams...)
+}
+
+func (ps SingleTablePersistenceStrategy) mergeAndLoad(ctx context.Context, fromPosition, count int, streams ...eventstore.LoadStreamParameter) (*DomainEventIterator, error) {
+	var paramCounter int
+	var queries []string
+	var parameters []interface{}
+
+	for _, stream := range streams {
+		query, values, err := ps.createQuery(ctx, stream.StreamName, stream.FromNumber, fromPosition, paramCounter, stream.Matcher)
+		if err != nil {
+			return nil, err
+		}
+
+		paramCounter += len(values)
+		queries = append(queries, "("+query+")")
+		parameters = append(parameters, values...)
+	}
+
+	groupedQuery := strings.Join(queries, " UNION ALL ")
+	it := ps.newIterator(ctx, groupedQuery, parameters, count)
+
+	if len(queries) > 1 || fromPosition > 0 {
+		it.orderBy = mergedStreamsOrder
+	}
+
+	return it, nil
+}
+
+func (ps SingleTablePersistenceStrategy) createQuery(ctx context.Context, streamName string, fromNumber, fromPosition, paramCounter int, matcher eventstore.MetadataMatcher) (string, []interface{}, error) {
+	err := ps.assertStreamExists(ctx, streamName)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+
+	wheres, values, err := createWhereClause(paramCounter, matcher, messageProperties)
+	if err != nil {
+		return "", []interface{}{}, err
+	}
+
+	wheres = append(wheres, fmt.Sprintf(`stream_name = $%d`, paramCounter+len(values)+1))
+	values = append(values, streamName)
+
+	wheres = append(wheres, fmt.Sprintf(`version >= $%d`, paramCounter+len(values)+1))
+	values = append(values, fromNumber)
+
+	if fromPosition > 0 {
+		wheres = append(wheres, fmt.Sprintf(`no >= $%d`, paramCounter+len(values)+1))
+		values = append(values, fromPosition)
+	}
+
+	whereCondition := fmt.Sprintf(`WHERE %s`, strings.Join(wheres, " AND "))
+
+	query := fmt.Sprintf(`SELECT version AS no, event_id, event_name, payload, metadata, created_at, stream_name AS stream, no AS position, content_type, payload_bytes FROM %s %s`, ps.table(EventsTable), whereCondition)
+
+	return query, values, nil
+}
+
+func NewSingleTablePersistenceStrategy(db *pgxpool.Pool, options ...Option) *SingleTablePersistenceStrategy {
+	return &SingleTablePersistenceStrategy{
+		streamRegistry: streamRegistry{config: newConfig(options), db: db, migrations: singleTableMigrations, strategy: singleTableStrategy},
+	}
+}
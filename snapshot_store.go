@@ -0,0 +1,160 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+	uuid "github.com/satori/go.uuid"
+)
+
+const SnapshotsTable = "snapshots"
+
+// Snapshot is the state of an Aggregate after applying all Events up to Version
+type Snapshot struct {
+	AggregateType string
+	AggregateID   uuid.UUID
+	Version       int
+	State         json.RawMessage
+	CreatedAt     time.Time
+}
+
+// Unmarshal decodes the persisted state into v
+func (s Snapshot) Unmarshal(v interface{}) error {
+	return json.Unmarshal(s.State, v)
+}
+
+// SnapshotPolicy decides if a new Snapshot should be taken for an Aggregate at version
+// snapshotVersion is the version of the latest Snapshot, 0 if there is none
+type SnapshotPolicy func(aggregateType string, snapshotVersion, version int) bool
+
+// EveryNEvents takes a Snapshot once at least n Events were recorded since the latest Snapshot
+func EveryNEvents(n int) SnapshotPolicy {
+	return func(aggregateType string, snapshotVersion, version int) bool {
+		return version-snapshotVersion >= n
+	}
+}
+
+type eventLoader interface {
+	Load(ctx context.Context, streamName string, fromNumber, count int, matcher eventstore.MetadataMatcher) (eventstore.DomainEventIterator, error)
+}
+
+// SnapshotStore persists the latest Snapshot per Aggregate
+type SnapshotStore struct {
+	config
+	db     *pgxpool.Pool
+	policy SnapshotPolicy
+}
+
+func (ss SnapshotStore) CreateSnapshotsTable(ctx context.Context) error {
+	err := ss.createSchema(ctx, ss.db)
+	if err != nil {
+		return err
+	}
+
+	exists, err := ss.tableExists(ctx, ss.db, SnapshotsTable)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+	_, err = ss.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			aggregate_type VARCHAR(150) NOT NULL,
+			aggregate_id UUID NOT NULL,
+			version INTEGER NOT NULL,
+			state JSONB NOT NULL,
+			created_at TIMESTAMP(6) NOT NULL,
+			PRIMARY KEY (aggregate_type, aggregate_id)
+		);`, ss.table(SnapshotsTable)))
+
+	return err
+}
+
+// Save persists the state of the Aggregate at version
+// An existing Snapshot is only replaced by a Snapshot of a higher version
+func (ss SnapshotStore) Save(ctx context.Context, aggregateType string, aggregateID uuid.UUID, version int, state interface{}) error {
+	_, err := ss.db.Exec(
+		ctx,
+		fmt.Sprintf(`
+			INSERT INTO %[1]s (aggregate_type, aggregate_id, version, state, created_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (aggregate_type, aggregate_id) DO UPDATE SET version = EXCLUDED.version, state = EXCLUDED.state, created_at = EXCLUDED.created_at
+			WHERE %[1]s.version < EXCLUDED.version`, ss.table(SnapshotsTable)),
+		aggregateType,
+		aggregateID.String(),
+		version,
+		state,
+		time.Now(),
+	)
+
+	return err
+}
+
+// SaveIfDue persists the state of the Aggregate at version if the SnapshotPolicy of the SnapshotStore decides so
+// snapshotVersion is the version of the Snapshot the Aggregate was loaded from, 0 if there was none
+func (ss SnapshotStore) SaveIfDue(ctx context.Context, aggregateType string, aggregateID uuid.UUID, snapshotVersion, version int, state interface{}) (bool, error) {
+	if ss.policy == nil || !ss.policy(aggregateType, snapshotVersion, version) {
+		return false, nil
+	}
+
+	return true, ss.Save(ctx, aggregateType, aggregateID, version, state)
+}
+
+// Get returns the latest Snapshot of the Aggregate or SnapshotNotFound
+func (ss SnapshotStore) Get(ctx context.Context, aggregateType string, aggregateID uuid.UUID) (Snapshot, error) {
+	snapshot := Snapshot{AggregateType: aggregateType, AggregateID: aggregateID}
+
+	row := ss.db.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT version, state, created_at FROM %s WHERE aggregate_type = $1 AND aggregate_id = $2`, ss.table(SnapshotsTable)),
+		aggregateType,
+		aggregateID.String(),
+	)
+
+	err := row.Scan(&snapshot.Version, &snapshot.State, &snapshot.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return snapshot, SnapshotNotFound{AggregateType: aggregateType, AggregateID: aggregateID}
+	}
+
+	return snapshot, err
+}
+
+// Delete removes the Snapshot of the Aggregate, for example after the shape of its state changed
+func (ss SnapshotStore) Delete(ctx context.Context, aggregateType string, aggregateID uuid.UUID) error {
+	_, err := ss.db.Exec(
+		ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE aggregate_type = $1 AND aggregate_id = $2`, ss.table(SnapshotsTable)),
+		aggregateType,
+		aggregateID.String(),
+	)
+
+	return err
+}
+
+// LoadAggregate returns the latest Snapshot of the Aggregate and its Events recorded after the Snapshot
+// Without a Snapshot the returned Snapshot has version 0 and all Events of the Aggregate are loaded
+func (ss SnapshotStore) LoadAggregate(ctx context.Context, loader eventLoader, streamName, aggregateType string, aggregateID uuid.UUID) (Snapshot, eventstore.DomainEventIterator, error) {
+	snapshot, err := ss.Get(ctx, aggregateType, aggregateID)
+	if _, ok := err.(SnapshotNotFound); err != nil && !ok {
+		return snapshot, nil, err
+	}
+
+	it, err := loader.Load(ctx, streamName, 0, 0, eventstore.MetadataMatcher{
+		{Field: "_aggregate_type", Value: aggregateType, Operation: eventstore.EqualsOperator, FieldType: eventstore.MetadataField},
+		{Field: "_aggregate_id", Value: aggregateID.String(), Operation: eventstore.EqualsOperator, FieldType: eventstore.MetadataField},
+		{Field: "_aggregate_version", Value: snapshot.Version, Operation: eventstore.GreaterThanOperator, FieldType: eventstore.MetadataField},
+	})
+
+	return snapshot, it, err
+}
+
+// NewSnapshotStore creates a SnapshotStore, policy decides when SaveIfDue takes a Snapshot and may be nil to only take Snapshots by Save
+func NewSnapshotStore(db *pgxpool.Pool, policy SnapshotPolicy, options ...Option) *SnapshotStore {
+	return &SnapshotStore{config: newConfig(options), db: db, policy: policy}
+}
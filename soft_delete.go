@@ -0,0 +1,122 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// SoftDeleteStream marks the EventStream as deleted without removing its Events
+// HasStream, FetchAllStreamNames, Load, appends, truncation and the stream metadata treat it as absent until UndeleteStream
+// or a purge by PurgeDeletedStreams, CreateStream returns StreamSoftDeleted for its name meanwhile
+func (sr streamRegistry) SoftDeleteStream(ctx context.Context, streamName string) error {
+	c, err := sr.db.Exec(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = $1 WHERE real_stream_name = $2 AND deleted_at IS NULL`, sr.table(EventStreamsTable)), time.Now(), streamName)
+	if err != nil {
+		return err
+	}
+	if c.RowsAffected() == 0 {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return nil
+}
+
+// UndeleteStream restores a soft deleted EventStream
+func (sr streamRegistry) UndeleteStream(ctx context.Context, streamName string) error {
+	c, err := sr.db.Exec(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL WHERE real_stream_name = $1 AND deleted_at IS NOT NULL`, sr.table(EventStreamsTable)), streamName)
+	if err != nil {
+		return err
+	}
+	if c.RowsAffected() == 0 {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return nil
+}
+
+// assertStreamWritable returns StreamNotFound if the EventStream does not exist or is soft deleted
+// The row of the EventStream is locked until the end of the transaction, so it can not be soft deleted during an append
+func (sr streamRegistry) assertStreamWritable(ctx context.Context, tx pgx.Tx, streamName string) error {
+	var exists bool
+
+	err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT TRUE FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL FOR SHARE`, sr.table(EventStreamsTable)), streamName).Scan(&exists)
+	if err == pgx.ErrNoRows {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return err
+}
+
+// purgeDeletedStreams removes all EventStreams soft deleted before the grace period and returns their names
+// dropSchema removes the Events of an EventStream within the transaction removing it, it is nil if they are removed by a cascade
+func (sr streamRegistry) purgeDeletedStreams(ctx context.Context, gracePeriod time.Duration, dropSchema func(ctx context.Context, db execer, streamName string) error) ([]string, error) {
+	purged := []string{}
+	deletedBefore := time.Now().Add(-gracePeriod)
+
+	rows, err := sr.db.Query(ctx, fmt.Sprintf(`SELECT real_stream_name FROM %s WHERE deleted_at < $1 ORDER BY no`, sr.table(EventStreamsTable)), deletedBefore)
+	if err != nil {
+		return purged, err
+	}
+	defer rows.Close()
+
+	streams := []string{}
+
+	for rows.Next() {
+		var stream string
+
+		err = rows.Scan(&stream)
+		if err != nil {
+			return purged, err
+		}
+
+		streams = append(streams, stream)
+	}
+	if rows.Err() != nil {
+		return purged, rows.Err()
+	}
+	rows.Close()
+
+	for _, stream := range streams {
+		ok, err := sr.purgeDeletedStream(ctx, stream, deletedBefore, dropSchema)
+		if err != nil {
+			return purged, err
+		}
+		if !ok {
+			continue
+		}
+
+		purged = append(purged, stream)
+	}
+
+	return purged, nil
+}
+
+// purgeDeletedStream removes the EventStream and its Events if it is still soft deleted before deletedBefore
+// It returns false without removing anything if the EventStream was undeleted in the meantime
+func (sr streamRegistry) purgeDeletedStream(ctx context.Context, streamName string, deletedBefore time.Time, dropSchema func(ctx context.Context, db execer, streamName string) error) (bool, error) {
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE real_stream_name = $1 AND deleted_at < $2`, sr.table(EventStreamsTable)), streamName, deletedBefore)
+	if err != nil {
+		return false, err
+	}
+	if c.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if dropSchema != nil {
+		err = dropSchema(ctx, tx, streamName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
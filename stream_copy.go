@@ -0,0 +1,102 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// renameStream renames the EventStream and its archive Table, renameEvents moves the Events within the same transaction
+func (sr streamRegistry) renameStream(ctx context.Context, from, to string, renameEvents func(ctx context.Context, tx pgx.Tx) error) error {
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(`UPDATE %s SET real_stream_name = $1, stream_name = $2 WHERE real_stream_name = $3 AND deleted_at IS NULL`, sr.table(EventStreamsTable)),
+		to,
+		GenerateTableName(to),
+		from,
+	)
+	if isUniqueViolation(err) {
+		return eventstore.StreamAlreadyExist{Stream: to}
+	}
+	if err != nil {
+		return err
+	}
+	if c.RowsAffected() == 0 {
+		return eventstore.StreamNotFound{Stream: from}
+	}
+
+	err = renameEvents(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(
+		`ALTER TABLE IF EXISTS %s RENAME TO %s`,
+		sr.table(GenerateArchiveTableName(from)),
+		pgx.Identifier{sr.prefix + GenerateArchiveTableName(to)}.Sanitize(),
+	))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// copyStream creates the EventStream to with the metadata of from and fills it by copyEvents within one transaction
+// createSchema creates the Table of to within the same transaction and is nil for strategies without a Table per EventStream,
+// so a failed copy leaves neither the EventStream nor its Table behind
+func (sr streamRegistry) copyStream(
+	ctx context.Context,
+	from, to string,
+	createSchema func(ctx context.Context, db execer, streamName string) error,
+	copyEvents func(ctx context.Context, tx pgx.Tx) (int64, error),
+) (int64, error) {
+	metadata, err := sr.FetchStreamMetadata(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = sr.insertStream(ctx, tx, to, metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	if createSchema != nil {
+		err = createSchema(ctx, tx, to)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to create Stream Schema: %s", err.Error())
+		}
+	}
+
+	err = sr.lockAppends(ctx, tx, to)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := copyEvents(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+// copiedEventID derives the event_id of a copied Event from the original event_id and the target EventStream
+// so copies never collide with their originals and copying the same Event twice into an EventStream is detected
+func copiedEventID(eventIDColumn, streamParameter string) string {
+	return fmt.Sprintf(`md5(%s::TEXT || %s::TEXT)::UUID`, eventIDColumn, streamParameter)
+}
@@ -0,0 +1,65 @@
+package pg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// StreamFilter restricts and pages the result of FetchStreamNames
+// All set conditions have to match
+type StreamFilter struct {
+	// Prefix matches EventStreams whose name starts with the given value
+	Prefix string
+	// Regex matches EventStreams whose name matches the given POSIX regular expression
+	Regex string
+	// Metadata matches EventStreams whose metadata contains the given metadata
+	Metadata map[string]interface{}
+	// IncludeSystemStreams includes EventStreams prefixed with $
+	IncludeSystemStreams bool
+	// Deleted matches soft deleted EventStreams instead of the available ones
+	Deleted bool
+	// After is a cursor and matches EventStreams created after the EventStream with the given creation number
+	After int
+	// Limit the number of returned EventStreams, 0 means no limit
+	Limit int
+	// Offset skips the given number of EventStreams
+	Offset int
+}
+
+func (f StreamFilter) whereClause() ([]string, []interface{}) {
+	var wheres []string
+	var values []interface{}
+
+	placeholder := func(value interface{}) string {
+		values = append(values, value)
+
+		return "$" + strconv.Itoa(len(values))
+	}
+
+	if f.Deleted {
+		wheres = append(wheres, `deleted_at IS NOT NULL`)
+	} else {
+		wheres = append(wheres, `deleted_at IS NULL`)
+	}
+	if !f.IncludeSystemStreams {
+		wheres = append(wheres, `real_stream_name NOT LIKE '$%'`)
+	}
+	if f.Prefix != "" {
+		wheres = append(wheres, `real_stream_name LIKE `+placeholder(escapeLike(f.Prefix)+"%"))
+	}
+	if f.Regex != "" {
+		wheres = append(wheres, `real_stream_name ~ `+placeholder(f.Regex))
+	}
+	if len(f.Metadata) > 0 {
+		wheres = append(wheres, `metadata @> `+placeholder(f.Metadata))
+	}
+	if f.After > 0 {
+		wheres = append(wheres, `no > `+placeholder(f.After))
+	}
+
+	return wheres, values
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
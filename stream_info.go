@@ -0,0 +1,138 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// StreamInfo summarizes the Events of an EventStream
+// FirstNumber and LastNumber are the numbers of the oldest and newest available Event, both are 0 for an empty EventStream
+// FirstCreatedAt and LastCreatedAt are their creation times, zero for an empty EventStream
+// Aggregates is the number of distinct aggregates, it is only counted by StreamsInfoWithAggregates
+type StreamInfo struct {
+	Stream         string
+	Events         int64
+	Aggregates     int64
+	FirstNumber    int
+	LastNumber     int
+	FirstCreatedAt time.Time
+	LastCreatedAt  time.Time
+}
+
+// streamEvents returns the Table and the condition with arguments selecting the Events of an EventStream
+type streamEvents func(streamName string, streamID int) (tableName, condition string, arguments []interface{})
+
+// streamInfoQuery selects the StreamInfo columns of the Events in the Table matching condition
+// Only numberColumn and the columns of condition are read, so Postgres counts the Events with an index only scan of the EventStream
+// and reads the first and last Event along the index on numberColumn
+func streamInfoQuery(tableName, numberColumn, condition string) string {
+	return fmt.Sprintf(`
+		SELECT counts.events, COALESCE(first.number, 0), first.created_at, COALESCE(last.number, 0), last.created_at
+		FROM (SELECT COUNT(%[2]s) AS events FROM %[1]s WHERE %[3]s) AS counts
+		LEFT JOIN LATERAL (SELECT %[2]s AS number, created_at FROM %[1]s WHERE %[3]s ORDER BY %[2]s ASC LIMIT 1) AS first ON TRUE
+		LEFT JOIN LATERAL (SELECT %[2]s AS number, created_at FROM %[1]s WHERE %[3]s ORDER BY %[2]s DESC LIMIT 1) AS last ON TRUE`,
+		tableName, numberColumn, condition,
+	)
+}
+
+// fetchStreamIDs resolves the internal ids of the EventStreams in one query, it returns StreamNotFound for the first unknown EventStream
+func (sr streamRegistry) fetchStreamIDs(ctx context.Context, streamNames []string) (map[string]int, error) {
+	rows, err := sr.db.Query(ctx, fmt.Sprintf(`SELECT real_stream_name, no FROM %s WHERE real_stream_name = ANY($1) AND deleted_at IS NULL`, sr.table(EventStreamsTable)), streamNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	streamIDs := map[string]int{}
+
+	for rows.Next() {
+		var streamName string
+		var streamID int
+
+		err = rows.Scan(&streamName, &streamID)
+		if err != nil {
+			return nil, err
+		}
+
+		streamIDs[streamName] = streamID
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, streamName := range streamNames {
+		if _, ok := streamIDs[streamName]; !ok {
+			return nil, eventstore.StreamNotFound{Stream: streamName}
+		}
+	}
+
+	return streamIDs, nil
+}
+
+// aggregatesQuery counts the distinct aggregate ids in the metadata of the Events in the Table matching condition
+// Unlike streamInfoQuery it has to read every Event of the EventStream
+func aggregatesQuery(tableName, condition string) string {
+	return fmt.Sprintf(`SELECT COUNT(DISTINCT metadata->>'_aggregate_id') FROM %s WHERE %s`, tableName, condition)
+}
+
+// streamsInfo resolves the EventStreams in one query and sends the statistics query of each EventStream in one batch
+// With aggregates the aggregatesQuery of each EventStream is sent in the same batch
+func (sr streamRegistry) streamsInfo(ctx context.Context, streamNames []string, numberColumn string, events streamEvents, aggregates bool) ([]StreamInfo, error) {
+	if len(streamNames) == 0 {
+		return []StreamInfo{}, nil
+	}
+
+	streamIDs, err := sr.fetchStreamIDs(ctx, streamNames)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &pgx.Batch{}
+
+	for _, streamName := range streamNames {
+		tableName, condition, arguments := events(streamName, streamIDs[streamName])
+		batch.Queue(streamInfoQuery(tableName, numberColumn, condition), arguments...)
+
+		if aggregates {
+			batch.Queue(aggregatesQuery(tableName, condition), arguments...)
+		}
+	}
+
+	results := sr.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	infos := make([]StreamInfo, 0, len(streamNames))
+
+	for _, streamName := range streamNames {
+		var firstCreatedAt, lastCreatedAt *time.Time
+
+		info := StreamInfo{Stream: streamName}
+
+		err = results.QueryRow().Scan(&info.Events, &info.FirstNumber, &firstCreatedAt, &info.LastNumber, &lastCreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if firstCreatedAt != nil {
+			info.FirstCreatedAt = *firstCreatedAt
+		}
+		if lastCreatedAt != nil {
+			info.LastCreatedAt = *lastCreatedAt
+		}
+
+		if aggregates {
+			err = results.QueryRow().Scan(&info.Aggregates)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
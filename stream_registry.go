@@ -0,0 +1,278 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+
+	eventstore "github.com/go-event-store/eventstore"
+)
+
+type streamRegistry struct {
+	config
+	db         *pgxpool.Pool
+	migrations []Migration
+	// strategy keys the applied Migrations, PersistenceStrategies sharing a schema reuse Versions for different changes
+	strategy string
+}
+
+func (sr streamRegistry) CreateEventStreamsTable(ctx context.Context) error {
+	err := sr.createSchema(ctx, sr.db)
+	if err != nil {
+		return err
+	}
+
+	if sr.outbox {
+		err = sr.createOutboxTable(ctx, sr.db)
+		if err != nil {
+			return err
+		}
+	}
+
+	exists, err := sr.tableExists(ctx, sr.db, EventStreamsTable)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+	_, err = sr.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			no BIGSERIAL,
+			real_stream_name VARCHAR(150) NOT NULL,
+			stream_name CHAR(41) NOT NULL,
+			metadata JSONB,
+			truncated_before BIGINT NOT NULL DEFAULT 0,
+			deleted_at TIMESTAMP(6),
+			PRIMARY KEY (no),
+			UNIQUE (stream_name)
+		);`, sr.table(EventStreamsTable)))
+	if err != nil {
+		return err
+	}
+
+	return sr.createStreamMetadataIndex(ctx, sr.db)
+}
+
+func (c config) createStreamMetadataIndex(ctx context.Context, db execer) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(
+		`CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (metadata jsonb_path_ops);`,
+		pgx.Identifier{c.prefix + EventStreamsTable + "_metadata_idx"}.Sanitize(),
+		c.table(EventStreamsTable),
+	))
+
+	return err
+}
+
+// CreateProjectionsTable is the last step of EventStore.Install and applies all pending Migrations afterwards
+func (sr streamRegistry) CreateProjectionsTable(ctx context.Context) error {
+	err := sr.createSchema(ctx, sr.db)
+	if err != nil {
+		return err
+	}
+
+	exists, err := sr.tableExists(ctx, sr.db, ProjectionsTable)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = sr.db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+            no BIGSERIAL,
+            name VARCHAR(150) NOT NULL,
+            position JSONB,
+            state JSONB,
+            status VARCHAR(28) NOT NULL,
+            locked_until TIMESTAMP(6),
+            PRIMARY KEY (no),
+            UNIQUE (name)
+		);`, sr.table(ProjectionsTable)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return sr.Migrate(ctx)
+}
+
+func (sr streamRegistry) AddStreamToStreamsTable(ctx context.Context, streamName string) error {
+	return sr.addStreamToStreamsTable(ctx, streamName, map[string]interface{}{})
+}
+
+func (sr streamRegistry) addStreamToStreamsTable(ctx context.Context, streamName string, metadata map[string]interface{}) error {
+	return sr.insertStream(ctx, sr.db, streamName, metadata)
+}
+
+func (sr streamRegistry) insertStream(ctx context.Context, db execer, streamName string, metadata map[string]interface{}) error {
+	tableName := GenerateTableName(streamName)
+	_, err := db.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (real_stream_name, stream_name, metadata) VALUES ($1, $2, $3)`, sr.table(EventStreamsTable)), streamName, tableName, metadata)
+	if !isUniqueViolation(err) {
+		return err
+	}
+
+	var deleted bool
+
+	err = sr.db.QueryRow(ctx, fmt.Sprintf(`SELECT deleted_at IS NOT NULL FROM %s WHERE real_stream_name = $1`, sr.table(EventStreamsTable)), streamName).Scan(&deleted)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+	if deleted {
+		return StreamSoftDeleted{Stream: streamName}
+	}
+
+	return eventstore.StreamAlreadyExist{Stream: streamName}
+}
+
+func (sr streamRegistry) createStream(ctx context.Context, streamName string, metadata map[string]interface{}, createSchema func(context.Context, string) error) error {
+	err := sr.addStreamToStreamsTable(ctx, streamName, metadata)
+	if err != nil {
+		return err
+	}
+
+	err = createSchema(ctx, streamName)
+	if err != nil {
+		err = sr.RemoveStreamFromStreamsTable(ctx, streamName)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to create Stream Schema: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (sr streamRegistry) FetchStreamMetadata(ctx context.Context, streamName string) (map[string]interface{}, error) {
+	metadata := map[string]interface{}{}
+
+	err := sr.db.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(metadata, '{}') FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL`, sr.table(EventStreamsTable)), streamName).Scan(&metadata)
+	if err == pgx.ErrNoRows {
+		return metadata, eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return metadata, err
+}
+
+// UpdateStreamMetadata replaces the metadata of the given EventStream
+func (sr streamRegistry) UpdateStreamMetadata(ctx context.Context, streamName string, metadata map[string]interface{}) error {
+	c, err := sr.db.Exec(ctx, fmt.Sprintf(`UPDATE %s SET metadata = $1 WHERE real_stream_name = $2 AND deleted_at IS NULL`, sr.table(EventStreamsTable)), metadata, streamName)
+	if err != nil {
+		return err
+	}
+	if c.RowsAffected() == 0 {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return nil
+}
+
+func (sr streamRegistry) RemoveStreamFromStreamsTable(ctx context.Context, streamName string) error {
+	c, err := sr.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE real_stream_name = $1`, sr.table(EventStreamsTable)), streamName)
+	if c.RowsAffected() == 0 {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return err
+}
+
+func (sr streamRegistry) FetchAllStreamNames(ctx context.Context) ([]string, error) {
+	streams, _, err := sr.FetchStreamNames(ctx, StreamFilter{})
+
+	return streams, err
+}
+
+// FetchStreamNamesByMetadata returns all EventStreams whose metadata contains the given metadata
+func (sr streamRegistry) FetchStreamNamesByMetadata(ctx context.Context, metadata map[string]interface{}) ([]string, error) {
+	streams, _, err := sr.FetchStreamNames(ctx, StreamFilter{Metadata: metadata})
+
+	return streams, err
+}
+
+// FetchStreamNames returns the EventStreams matching the filter in creation order
+// The returned cursor is the creation number of the last returned EventStream and can be used as StreamFilter.After to fetch the next page
+func (sr streamRegistry) FetchStreamNames(ctx context.Context, filter StreamFilter) (streams []string, cursor int, err error) {
+	streams = []string{}
+	cursor = filter.After
+
+	wheres, values := filter.whereClause()
+	query := fmt.Sprintf(`SELECT no, real_stream_name FROM %s`, sr.table(EventStreamsTable))
+
+	if len(wheres) > 0 {
+		query = fmt.Sprintf(`%s WHERE %s`, query, strings.Join(wheres, " AND "))
+	}
+
+	query += ` ORDER BY no ASC`
+
+	if filter.Limit > 0 {
+		query = fmt.Sprintf(`%s LIMIT %d`, query, filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = fmt.Sprintf(`%s OFFSET %d`, query, filter.Offset)
+	}
+
+	rows, err := sr.db.Query(ctx, query, values...)
+	if err != nil {
+		return streams, cursor, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stream string
+
+		err = rows.Scan(&cursor, &stream)
+		if err != nil {
+			return []string{}, filter.After, err
+		}
+
+		streams = append(streams, stream)
+	}
+
+	return streams, cursor, rows.Err()
+}
+
+func (sr streamRegistry) HasStream(ctx context.Context, streamName string) (bool, error) {
+	c, err := sr.db.Exec(ctx, fmt.Sprintf(`SELECT real_stream_name FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL`, sr.table(EventStreamsTable)), streamName)
+	if err != nil {
+		return false, err
+	}
+	if c.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (sr streamRegistry) assertStreamExists(ctx context.Context, streamName string) error {
+	ok, err := sr.HasStream(ctx, streamName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+
+	return nil
+}
+
+func (sr streamRegistry) newIterator(ctx context.Context, query string, parameters []interface{}, count int) *DomainEventIterator {
+	it := NewDomainEventIterator(ctx, sr.db, query, parameters, count)
+	it.streaming = sr.streaming
+	it.upcasters = sr.upcasters
+	it.serializers = sr.serializers
+
+	return it
+}
+
+func (sr streamRegistry) newReverseIterator(ctx context.Context, query string, parameters []interface{}, fromNumber, count int) *DomainEventIterator {
+	it := sr.newIterator(ctx, query, parameters, count)
+	it.descending = true
+
+	if fromNumber > 0 {
+		it.firstKey = map[string]interface{}{"no": fromNumber + 1}
+		it.lastKey = it.firstKey
+	}
+
+	return it
+}
@@ -0,0 +1,84 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	eventstore "github.com/go-event-store/eventstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// GenerateArchiveTableName returns the name of the Table receiving the archived Events of a truncated EventStream
+func GenerateArchiveTableName(streamName string) string {
+	return GenerateTableName(streamName) + "_archive"
+}
+
+// truncateStream removes the Events matching condition from the Table and raises the truncation point of the EventStream to number
+// $1 in condition is the number, the arguments start at $2
+// With archive the removed Events are moved into the archive Table of the EventStream, which is kept after DeleteStream
+func (sr streamRegistry) truncateStream(ctx context.Context, streamName string, number int, archive bool, tableName, condition string, arguments ...interface{}) (int64, error) {
+	tx, err := sr.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var streamID int
+
+	err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT no FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL FOR UPDATE`, sr.table(EventStreamsTable)), streamName).Scan(&streamID)
+	if err == pgx.ErrNoRows {
+		return 0, eventstore.StreamNotFound{Stream: streamName}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, sr.table(tableName), condition)
+
+	if archive {
+		archiveTable := sr.table(GenerateArchiveTableName(streamName))
+
+		_, err = tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE %s)`, archiveTable, sr.table(tableName)))
+		if err != nil {
+			return 0, err
+		}
+
+		query = fmt.Sprintf(`WITH archived AS (%s RETURNING *) INSERT INTO %s SELECT * FROM archived`, query, archiveTable)
+	}
+
+	tag, err := tx.Exec(ctx, query, append([]interface{}{number}, arguments...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET truncated_before = GREATEST(truncated_before, $1) WHERE no = $2`, sr.table(EventStreamsTable)), number, streamID)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+// assertNotTruncated returns StreamTruncated if fromNumber is before the truncation point of the EventStream
+// A fromNumber of 0 loads from the oldest available Event and is never reported
+func (sr streamRegistry) assertNotTruncated(ctx context.Context, streamName string, fromNumber int) error {
+	if fromNumber <= 0 {
+		return nil
+	}
+
+	var truncatedBefore int
+
+	err := sr.db.QueryRow(ctx, fmt.Sprintf(`SELECT truncated_before FROM %s WHERE real_stream_name = $1 AND deleted_at IS NULL`, sr.table(EventStreamsTable)), streamName).Scan(&truncatedBefore)
+	if err == pgx.ErrNoRows {
+		return eventstore.StreamNotFound{Stream: streamName}
+	}
+	if err != nil {
+		return err
+	}
+
+	if fromNumber < truncatedBefore {
+		return StreamTruncated{Stream: streamName, FromNumber: fromNumber, TruncatedBefore: truncatedBefore}
+	}
+
+	return nil
+}
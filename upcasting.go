@@ -0,0 +1,121 @@
+package pg
+
+import (
+	eventstore "github.com/go-event-store/eventstore"
+)
+
+// SchemaVersionKey is the metadata key of the payload schema version of an Event
+// Events appended before their first Upcaster was registered have no schema version and are treated as version 0
+const SchemaVersionKey = "_schema_version"
+
+// RawEvent is a loaded Event before its payload is decoded into the registered Go type of its name
+// The Payload is encoded with the Serializer of the ContentType, an Upcaster can change both
+type RawEvent struct {
+	Name        string
+	ContentType string
+	Payload     []byte
+	Metadata    map[string]interface{}
+}
+
+// Upcaster transforms a RawEvent of one schema version into the shape of the next schema version
+// It can change the payload and metadata or rename the Event, the schema version is raised by the Upcasters afterwards
+type Upcaster func(event RawEvent) (RawEvent, error)
+
+// Upcasters is the pipeline of registered Upcasters, keyed by event name and the schema version they upcast from
+// Loaded Events are passed through all Upcasters of their name from their schema version on, persisted Events are never rewritten
+type Upcasters struct {
+	upcasters map[string]map[int]Upcaster
+}
+
+// Register adds the Upcaster for Events with the given name and schema version
+// An Upcaster registered for version n raises the Events to version n+1, which is the version stamped on newly appended Events of the name
+func (u *Upcasters) Register(eventName string, schemaVersion int, upcaster Upcaster) *Upcasters {
+	if _, ok := u.upcasters[eventName]; !ok {
+		u.upcasters[eventName] = map[int]Upcaster{}
+	}
+
+	u.upcasters[eventName][schemaVersion] = upcaster
+
+	return u
+}
+
+// CurrentVersion returns the schema version of Events with the given name after all registered Upcasters were applied
+func (u *Upcasters) CurrentVersion(eventName string) int {
+	current := 0
+
+	for version := range u.upcasters[eventName] {
+		if version+1 > current {
+			current = version + 1
+		}
+	}
+
+	return current
+}
+
+// Upcast applies the registered Upcasters to the RawEvent until no Upcaster is registered for its name and schema version
+// A renamed Event continues with the Upcasters of its new name, starting at the raised schema version
+func (u *Upcasters) Upcast(event RawEvent) (RawEvent, error) {
+	for {
+		version := SchemaVersion(event.Metadata)
+
+		upcaster, ok := u.upcasters[event.Name][version]
+		if !ok {
+			return event, nil
+		}
+
+		upcasted, err := upcaster(event)
+		if err != nil {
+			return event, err
+		}
+
+		if upcasted.Metadata == nil {
+			upcasted.Metadata = map[string]interface{}{}
+		}
+
+		upcasted.Metadata[SchemaVersionKey] = version + 1
+		event = upcasted
+	}
+}
+
+// SchemaVersion returns the payload schema version stored in the metadata of an Event
+func SchemaVersion(metadata map[string]interface{}) int {
+	switch v := metadata[SchemaVersionKey].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// NewUpcasters creates an empty Upcaster pipeline, use it with WithUpcasters
+func NewUpcasters() *Upcasters {
+	return &Upcasters{upcasters: map[string]map[int]Upcaster{}}
+}
+
+// eventMetadata returns the metadata to persist for an appended Event
+// The keys added by the DomainEventIterator are removed, so re-appended loaded Events do not persist their old EventStream and position
+// With Upcasters the current schema version of the event name is added, unless the Event already carries one
+func (c config) eventMetadata(event eventstore.DomainEvent) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(event.Metadata())+1)
+
+	for key, value := range event.Metadata() {
+		if key == StreamKey || key == positionKey {
+			continue
+		}
+
+		metadata[key] = value
+	}
+
+	if c.upcasters == nil {
+		return metadata
+	}
+
+	version := c.upcasters.CurrentVersion(event.Name())
+	if _, ok := metadata[SchemaVersionKey]; !ok && version > 0 {
+		metadata[SchemaVersionKey] = version
+	}
+
+	return metadata
+}